@@ -0,0 +1,134 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+	"github.com/gammazero/nexus/wamp/crsign"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// EnvAuthMethod defines the environment variable name for the authentication method the
+// service is using to authenticate on the broker.
+const EnvAuthMethod string = "SERVICE_AUTH_METHOD"
+
+// Authentication methods which can be selected with --auth-method. When no method is
+// selected, it is derived from the provided credentials.
+const (
+	authAnonymous = "anonymous"
+	authTicket    = "ticket"
+	authWampCRA   = "wampcra"
+	authTLS       = "tls"
+)
+
+// selectAuthMethod validates the requested authentication method against the credentials
+// loaded by `NewE` and stores the method to use.
+func (srv *Service) selectAuthMethod(method, username, password string) error {
+	switch method {
+	case "":
+		if srv.useTLS && srv.clientCert != nil {
+			srv.authMethod = authTLS
+		} else if srv.cryptosignKey != nil {
+			srv.username = username
+			srv.useAuth = true
+			srv.authMethod = authCryptosign
+		} else if !srv.useAuth {
+			srv.authMethod = authAnonymous
+		} else {
+			srv.authMethod = authTicket
+		}
+		return nil
+	case authTicket, authWampCRA:
+		if username == "" || password == "" {
+			return newExitError(ExitArgument, "Authentication method '%s' requires username and password!", method)
+		}
+		srv.username = username
+		srv.password = password
+	case authTLS:
+		if !srv.useTLS || srv.clientCert == nil {
+			return newExitError(ExitArgument, "Authentication method '%s' requires a TLS connection and client certificate!", method)
+		}
+	case authCryptosign:
+		if srv.cryptosignKey == nil {
+			return newExitError(ExitArgument, "Authentication method '%s' requires a private key!", method)
+		}
+		srv.username = username
+	case authAnonymous:
+		srv.useAuth = false
+		srv.authMethod = method
+		return nil
+	default:
+		return newExitError(ExitArgument, "Unknown authentication method '%s'!", method)
+	}
+	srv.useAuth = true
+	srv.authMethod = method
+	return nil
+}
+
+// helloDetails returns the authentication details sent to the router when joining the realm.
+func (srv *Service) helloDetails() wamp.Dict {
+	details := wamp.Dict{
+		"authid": srv.username,
+	}
+	if srv.authMethod == authCryptosign {
+		details["authextra"] = wamp.Dict{
+			"pubkey": srv.cryptosignPublicKey(),
+		}
+	}
+	return details
+}
+
+// authHandlers returns the challenge handlers for the selected authentication method.
+func (srv *Service) authHandlers() map[string]client.AuthFunc {
+	authMethods := make(map[string]client.AuthFunc)
+	switch srv.authMethod {
+	case authTLS:
+		authMethods[authTLS] = func(_ *wamp.Challenge) (string, wamp.Dict) {
+			return "", wamp.Dict{}
+		}
+	case authTicket:
+		authMethods[authTicket] = func(_ *wamp.Challenge) (string, wamp.Dict) {
+			return srv.currentPassword(), wamp.Dict{}
+		}
+	case authWampCRA:
+		authMethods[authWampCRA] = func(c *wamp.Challenge) (string, wamp.Dict) {
+			return signWampCRAChallenge(srv.currentPassword(), c), wamp.Dict{}
+		}
+	case authCryptosign:
+		authMethods[authCryptosign] = srv.signCryptosignChallenge
+	}
+	return authMethods
+}
+
+// signWampCRAChallenge computes the WAMP-CRA signature of the challenge. When the router
+// provides salting information, the key is derived from the password using PBKDF2 and
+// used base64 encoded, the same way as Autobahn and Crossbar do.
+func signWampCRAChallenge(password string, c *wamp.Challenge) string {
+	challenge, _ := wamp.AsString(c.Extra["challenge"])
+	salt, _ := wamp.AsString(c.Extra["salt"])
+	if salt == "" {
+		return crsign.SignChallenge(challenge, []byte(password))
+	}
+
+	iterations, _ := wamp.AsInt64(c.Extra["iterations"])
+	keylen, _ := wamp.AsInt64(c.Extra["keylen"])
+	if iterations == 0 {
+		iterations = 1000
+	}
+	if keylen == 0 {
+		keylen = 32
+	}
+	key := pbkdf2.Key([]byte(password), []byte(salt), int(iterations), int(keylen), sha256.New)
+	return crsign.SignChallenge(challenge, []byte(base64.StdEncoding.EncodeToString(key)))
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestSelectAuthMethod(t *testing.T) {
+	srv := &Service{useAuth: true}
+	if err := srv.selectAuthMethod("", "", ""); err != nil || srv.authMethod != authTicket {
+		t.Errorf("Expected ticket authentication by default, got: %s (%v)", srv.authMethod, err)
+	}
+	if err := srv.selectAuthMethod(authWampCRA, "user", ""); err == nil {
+		t.Error("Expected error for wampcra without password")
+	}
+	if err := srv.selectAuthMethod(authTLS, "", ""); err == nil {
+		t.Error("Expected error for tls without client certificate")
+	}
+	if err := srv.selectAuthMethod("invalid", "user", "secret"); err == nil {
+		t.Error("Expected error for unknown authentication method")
+	}
+}
+
+func TestWampCRAHandler(t *testing.T) {
+	srv := &Service{}
+	if err := srv.selectAuthMethod(authWampCRA, "user", "secret"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	handler, ok := srv.authHandlers()[authWampCRA]
+	if !ok {
+		t.Fatal("Expected wampcra handler")
+	}
+
+	// known signatures of the challenge '{}' with the password 'secret', the salted one
+	// signed with the PBKDF2-SHA256 derived key
+	challenges := map[string]*wamp.Challenge{
+		"dzJZAsrKgS3CWXM6rNBGtzgXNyx3e42VtAJkdHRRbhM=": {AuthMethod: authWampCRA, Extra: wamp.Dict{"challenge": "{}"}},
+		"3/yI4nsv3VFflTKrPgU1wfLgPFBp/6+u9ps+9uIMYH0=": {AuthMethod: authWampCRA, Extra: wamp.Dict{"challenge": "{}", "salt": "salt", "iterations": 100, "keylen": 16}},
+	}
+	for expected, c := range challenges {
+		if signature, _ := handler(c); signature != expected {
+			t.Errorf("Expected signature '%s', got: %s", expected, signature)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	flag "github.com/ogier/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvConfigFile defines the environment variable name for the path of the configuration file.
+const EnvConfigFile string = "SERVICE_CONFIG"
+
+// redacted replaces the value of secret settings when printing the configuration.
+const redacted string = "<redacted>"
+
+// setting describes a command line flag which can also be provided by an environment
+// variable or the configuration file. Command line flags take precedence over environment
+// variables, which take precedence over the configuration file.
+type setting struct {
+	name    string
+	env     string
+	secret  bool
+	fileEnv string
+}
+
+// lookupEnv returns the value of the environment variable of the setting. For secret
+// settings, the file named by the `_FILE` variant is read when the variable is not set.
+func (st setting) lookupEnv() (string, error) {
+	value := os.Getenv(st.env)
+	if value != "" || st.fileEnv == "" {
+		return value, nil
+	}
+	if fname := os.Getenv(st.fileEnv); fname != "" {
+		return readSecretFile(st.fileEnv, fname)
+	}
+	return "", nil
+}
+
+// mergeFlags adds all flags of src to dst, which are not defined there yet. The flags share
+// their values, shorthands already used in dst are dropped.
+func mergeFlags(dst, src *flag.FlagSet) {
+	shorthands := map[string]bool{}
+	dst.VisitAll(func(f *flag.Flag) {
+		shorthands[f.Shorthand] = true
+	})
+	src.VisitAll(func(f *flag.Flag) {
+		if dst.Lookup(f.Name) != nil {
+			return
+		}
+		shorthand := f.Shorthand
+		if shorthands[shorthand] {
+			shorthand = ""
+		}
+		shorthands[shorthand] = true
+		dst.VarP(f.Value, f.Name, shorthand, f.Usage)
+	})
+}
+
+// settings defines command line flags and keeps track of the environment variables and
+// configuration file keys that belong to them.
+type settings struct {
+	flags *flag.FlagSet
+	list  []setting
+}
+
+func newSettings(flags *flag.FlagSet) *settings {
+	return &settings{
+		flags: flags,
+	}
+}
+
+// String defines a string flag that defaults to the value of the given environment variable.
+func (s *settings) String(name, shorthand, env, usage string) *string {
+	s.list = append(s.list, setting{name: name, env: env})
+	return s.flags.StringP(name, shorthand, os.Getenv(env), usage)
+}
+
+// Secret defines a string flag just like `String`, but its value is redacted when the
+// configuration is printed. The value may also be read from the file named by the
+// environment variable suffixed with `_FILE`, unless a previously defined setting already
+// uses that environment variable, e.g. `SERVICE_CRYPTOSIGN_KEY_FILE`.
+func (s *settings) Secret(name, shorthand, env, usage string) (*string, error) {
+	st := setting{name: name, env: env, secret: true, fileEnv: s.fileEnv(env)}
+	envVal, err := st.lookupEnv()
+	if err != nil {
+		return nil, err
+	}
+	s.list = append(s.list, st)
+	return s.flags.StringP(name, shorthand, envVal, usage), nil
+}
+
+// fileEnv returns the `_FILE` variant of the environment variable of a secret setting, or
+// an empty string if it is already used by another setting.
+func (s *settings) fileEnv(env string) string {
+	fileEnv := env + EnvFileSuffix
+	for _, st := range s.list {
+		if st.env == fileEnv {
+			return ""
+		}
+	}
+	return fileEnv
+}
+
+// Bool defines a bool flag that defaults to the value of the given environment variable,
+// or to def if the environment variable is not set.
+func (s *settings) Bool(name, env string, def bool, usage string) (*bool, error) {
+	if envVal, envSet := os.LookupEnv(env); envSet {
+		enable, err := strconv.ParseBool(envVal)
+		if err != nil {
+			return nil, newExitError(ExitArgument, "Failed to parse %s environment variable: %v", env, err)
+		}
+		def = enable
+	}
+	s.list = append(s.list, setting{name: name, env: env})
+	return s.flags.Bool(name, def, usage), nil
+}
+
+// Var defines a flag with a custom value, the value of the given environment variable is
+// applied to it if set.
+func (s *settings) Var(value flag.Value, name, env, usage string, secret bool) error {
+	st := setting{name: name, env: env, secret: secret}
+	if secret {
+		st.fileEnv = s.fileEnv(env)
+	}
+	envVal, err := st.lookupEnv()
+	if err != nil {
+		return err
+	}
+	if envVal != "" {
+		if err := value.Set(envVal); err != nil {
+			return newExitError(ExitArgument, "Failed to parse %s environment variable: %v", env, err)
+		}
+	}
+	s.list = append(s.list, st)
+	s.flags.Var(value, name, usage)
+	return nil
+}
+
+// Apply sets all flags from the given configuration file values, unless the flag was
+// given on the command line or its environment variable is set.
+func (s *settings) Apply(values map[string]string) error {
+	changed := make(map[string]bool)
+	s.flags.Visit(func(f *flag.Flag) {
+		changed[f.Name] = true
+	})
+
+	known := make(map[string]setting)
+	for _, st := range s.list {
+		known[st.name] = st
+	}
+
+	for name, value := range values {
+		st, ok := known[name]
+		if !ok {
+			return newExitError(ExitArgument, "Unknown setting '%s' in configuration file", name)
+		}
+		if changed[name] || os.Getenv(st.env) != "" || (st.fileEnv != "" && os.Getenv(st.fileEnv) != "") {
+			continue
+		}
+		if err := s.flags.Set(name, value); err != nil {
+			return newExitError(ExitArgument, "Invalid value for setting '%s' in configuration file: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// SecretFile returns the file the value of the named secret setting was read from using the
+// `_FILE` environment variable, or an empty string if the value was provided otherwise.
+func (s *settings) SecretFile(name string) string {
+	changed := false
+	s.flags.Visit(func(f *flag.Flag) {
+		changed = changed || f.Name == name
+	})
+	for _, st := range s.list {
+		if st.name == name && st.fileEnv != "" && !changed && os.Getenv(st.env) == "" {
+			return os.Getenv(st.fileEnv)
+		}
+	}
+	return ""
+}
+
+// Resolve asks the secret provider for the values of all secret settings which are still
+// empty after the command line, the environment and the configuration file were applied.
+func (s *settings) Resolve(provider SecretProvider) error {
+	for _, st := range s.list {
+		if !st.secret || s.flags.Lookup(st.name).Value.String() != "" {
+			continue
+		}
+		value, ok, err := provider.Secret(st.name)
+		if err != nil {
+			return newExitError(ExitArgument, "Failed to resolve secret '%s': %s", st.name, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := s.flags.Set(st.name, value); err != nil {
+			return newExitError(ExitArgument, "Invalid value for secret '%s': %s", st.name, err)
+		}
+	}
+	return nil
+}
+
+// Print writes the effective configuration to w in YAML format, the values of secret
+// settings are redacted.
+func (s *settings) Print(w io.Writer) error {
+	config := yaml.MapSlice{}
+	for _, st := range s.list {
+		value := s.flags.Lookup(st.name).Value.String()
+		if st.secret && value != "" {
+			value = redacted
+		}
+		config = append(config, yaml.MapItem{Key: st.name, Value: value})
+	}
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// loadConfigFile reads a flat configuration file mapping setting names to values.
+// The format is chosen by the file extension, supported are YAML, TOML and JSON. List
+// values are joined by comma.
+func loadConfigFile(fname string) (map[string]string, error) {
+	if err := ensureFileExists("configuration file", fname); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, newExitError(ExitArgument, "Failed to read configuration file: %s", err)
+	}
+
+	raw := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	case ".json":
+		err = json.Unmarshal(content, &raw)
+	default:
+		return nil, newExitError(ExitArgument, "Unsupported configuration file format '%s'", filepath.Ext(fname))
+	}
+	if err != nil {
+		return nil, newExitError(ExitArgument, "Failed to parse configuration file: %s", err)
+	}
+
+	values := make(map[string]string)
+	for name, value := range raw {
+		var ok bool
+		if list, isList := value.([]interface{}); isList {
+			// lists are passed to the flag joined by comma, just like on the command line
+			parts := make([]string, len(list))
+			ok = true
+			for i := 0; i < len(list) && ok; i++ {
+				parts[i], ok = configValue(list[i])
+			}
+			values[name] = strings.Join(parts, ",")
+		} else {
+			values[name], ok = configValue(value)
+		}
+		if !ok {
+			return nil, newExitError(ExitArgument, "Setting '%s' in configuration file must be a scalar value or a list of scalars", name)
+		}
+	}
+	return values, nil
+}
+
+// configValue returns the string representation of a scalar value of a configuration file.
+func configValue(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string, bool, int, int64, float64:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
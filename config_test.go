@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flag "github.com/ogier/pflag"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	fname := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(fname, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	return fname
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "realm: realm1\nping-enable: false\nreconnect-attempts: 3\nbroker-url: [a, b]\n",
+		"config.toml": "realm = \"realm1\"\nping-enable = false\nreconnect-attempts = 3\nbroker-url = [\"a\", \"b\"]\n",
+		"config.json": `{"realm": "realm1", "ping-enable": false, "reconnect-attempts": 3, "broker-url": ["a", "b"]}`,
+	}
+	for name, content := range files {
+		fname := writeConfigFile(t, name, content)
+		defer os.RemoveAll(filepath.Dir(fname))
+
+		values, err := loadConfigFile(fname)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got: %v", name, err)
+		}
+		if values["realm"] != "realm1" || values["ping-enable"] != "false" || values["reconnect-attempts"] != "3" || values["broker-url"] != "a,b" {
+			t.Errorf("Unexpected values for %s: %v", name, values)
+		}
+	}
+
+	fname := writeConfigFile(t, "config.yaml", "realm:\n  nested: true\n")
+	defer os.RemoveAll(filepath.Dir(fname))
+	if _, err := loadConfigFile(fname); err == nil {
+		t.Error("Expected error for nested configuration value")
+	}
+
+	fname = writeConfigFile(t, "config.yaml", "broker-url:\n  - nested: true\n")
+	defer os.RemoveAll(filepath.Dir(fname))
+	if _, err := loadConfigFile(fname); err == nil {
+		t.Error("Expected error for nested list item")
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	os.Setenv("SERVICE_TEST_FROM_ENV", "env")
+	defer os.Unsetenv("SERVICE_TEST_FROM_ENV")
+
+	opts := newSettings(flag.NewFlagSet("test", flag.ContinueOnError))
+	fromFlag := opts.String("from-flag", "", "SERVICE_TEST_FROM_FLAG", "")
+	fromEnv := opts.String("from-env", "", "SERVICE_TEST_FROM_ENV", "")
+	fromFile, _ := opts.Secret("from-file", "", "SERVICE_TEST_FROM_FILE", "")
+	if err := opts.flags.Parse([]string{"--from-flag=flag"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	err := opts.Apply(map[string]string{
+		"from-flag": "file",
+		"from-env":  "file",
+		"from-file": "file",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if *fromFlag != "flag" || *fromEnv != "env" || *fromFile != "file" {
+		t.Errorf("Unexpected precedence: flag=%s env=%s file=%s", *fromFlag, *fromEnv, *fromFile)
+	}
+
+	if err := opts.Apply(map[string]string{"unknown": "value"}); err == nil {
+		t.Error("Expected error for unknown setting")
+	}
+
+	out := &bytes.Buffer{}
+	if err := opts.Print(out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if strings.Contains(out.String(), "from-file: file") || !strings.Contains(out.String(), redacted) {
+		t.Errorf("Expected secret to be redacted, got: %s", out.String())
+	}
+}
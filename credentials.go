@@ -0,0 +1,168 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// EnvCredentialsReloadInterval defines the environment variable name for the interval in
+// which the TLS files and the password file are checked for changes
+const EnvCredentialsReloadInterval string = "SERVICE_CREDENTIALS_RELOAD_INTERVAL"
+
+func loadServerCert(fname string) (*x509.CertPool, error) {
+	if err := ensureFileExists("TLS server public key", fname); err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	certPEM, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, newExitError(ExitArgument, "Failed to load TLS server public key: %s", err)
+	}
+	if !pool.AppendCertsFromPEM(certPEM) {
+		return nil, newExitError(ExitArgument, "Failed to import server certificate/CA to trust!")
+	}
+	return pool, nil
+}
+
+func loadClientCert(certFile, keyFile string) (*tls.Certificate, error) {
+	if err := ensureFileExists("TLS client public key", certFile); err != nil {
+		return nil, err
+	}
+	if err := ensureFileExists("TLS client private key", keyFile); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, newExitError(ExitArgument, "Failed to load TLS client certificate: %s", err)
+	}
+	return &cert, nil
+}
+
+// watchCredentials remembers the modification time of a credential file to detect
+// rotations later on.
+func (srv *Service) watchCredentials(files ...string) {
+	srv.credentialsLock.Lock()
+	defer srv.credentialsLock.Unlock()
+	if srv.credentialFiles == nil {
+		srv.credentialFiles = make(map[string]time.Time)
+	}
+	for _, fname := range files {
+		srv.credentialFiles[fname] = modTime(fname)
+	}
+}
+
+func modTime(fname string) time.Time {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// changed reports whether any of the given credential files was modified since it was
+// last seen and remembers the new modification times.
+func (srv *Service) changed(files ...string) bool {
+	changed := false
+	for _, fname := range files {
+		if fname == "" {
+			continue
+		}
+		last, watched := srv.credentialFiles[fname]
+		if !watched {
+			continue
+		}
+		if current := modTime(fname); !current.Equal(last) {
+			srv.credentialFiles[fname] = current
+			changed = true
+		}
+	}
+	return changed
+}
+
+// reloadCredentials reloads the TLS files and the password file if they were modified.
+// The new material is used for the next connection to the broker. When loading fails,
+// the previous credentials are kept.
+func (srv *Service) reloadCredentials() {
+	srv.credentialsLock.Lock()
+	defer srv.credentialsLock.Unlock()
+
+	if srv.changed(srv.serverCertFile) {
+		if pool, err := loadServerCert(srv.serverCertFile); err != nil {
+			srv.Logger.Errorf("Failed to reload TLS server certificate: %s", err)
+		} else {
+			srv.serverCert = pool
+			srv.Logger.Infof("Reloaded TLS server certificate from '%s'", srv.serverCertFile)
+		}
+	}
+
+	if srv.changed(srv.clientCertFile, srv.clientKeyFile) {
+		if cert, err := loadClientCert(srv.clientCertFile, srv.clientKeyFile); err != nil {
+			srv.Logger.Errorf("Failed to reload TLS client certificate: %s", err)
+		} else {
+			srv.clientCert = cert
+			srv.Logger.Infof("Reloaded TLS client certificate from '%s'", srv.clientCertFile)
+		}
+	}
+
+	if srv.changed(srv.passwordFile) {
+		if password, err := readSecretFile("password file", srv.passwordFile); err != nil {
+			srv.Logger.Errorf("Failed to reload password: %s", err)
+		} else {
+			srv.password = password
+			srv.Logger.Infof("Reloaded password from '%s'", srv.passwordFile)
+		}
+	}
+}
+
+// runCredentialsReload periodically checks the credential files for changes until done
+// is closed.
+func (srv *Service) runCredentialsReload(done <-chan struct{}) {
+	if srv.credentialsReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(srv.credentialsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			srv.reloadCredentials()
+		}
+	}
+}
+
+func (srv *Service) currentPassword() string {
+	srv.credentialsLock.RLock()
+	defer srv.credentialsLock.RUnlock()
+	return srv.password
+}
+
+func (srv *Service) currentServerCert() *x509.CertPool {
+	srv.credentialsLock.RLock()
+	defer srv.credentialsLock.RUnlock()
+	return srv.serverCert
+}
+
+// getClientCertificate implements `tls.Config.GetClientCertificate` and always presents
+// the most recently loaded client certificate.
+func (srv *Service) getClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	srv.credentialsLock.RLock()
+	defer srv.credentialsLock.RUnlock()
+	if srv.clientCert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return srv.clientCert, nil
+}
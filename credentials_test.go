@@ -0,0 +1,52 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+func TestReloadPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(fname, []byte("old\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	srv := &Service{
+		Logger:       logging.MustGetLogger("test"),
+		password:     "old",
+		passwordFile: fname,
+	}
+	srv.watchCredentials(fname)
+
+	srv.reloadCredentials()
+	if password := srv.currentPassword(); password != "old" {
+		t.Errorf("Expected unchanged password, got: %s", password)
+	}
+
+	if err := ioutil.WriteFile(fname, []byte("new\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(fname, later, later); err != nil {
+		t.Fatalf("Failed to change modification time: %v", err)
+	}
+
+	srv.reloadCredentials()
+	if password := srv.currentPassword(); password != "new" {
+		t.Errorf("Expected rotated password, got: %s", password)
+	}
+
+	if _, err := loadServerCert(fname); err == nil {
+		t.Error("Expected error for invalid server certificate")
+	}
+}
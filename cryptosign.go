@@ -0,0 +1,115 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/gammazero/nexus/wamp"
+	"golang.org/x/crypto/ed25519"
+)
+
+// EnvCryptosignKey defines the environment variable name for the hex encoded Ed25519 private
+// key the service is using to authenticate on the broker with WAMP-Cryptosign.
+const EnvCryptosignKey string = "SERVICE_CRYPTOSIGN_KEY"
+
+// EnvCryptosignKeyFile defines the environment variable name for the file containing the hex
+// encoded Ed25519 private key the service is using to authenticate on the broker with
+// WAMP-Cryptosign.
+const EnvCryptosignKeyFile string = "SERVICE_CRYPTOSIGN_KEY_FILE"
+
+const authCryptosign = "cryptosign"
+
+// GenerateCryptosignKey creates a new Ed25519 keypair for WAMP-Cryptosign authentication.
+// It returns the hex encoded private key seed, which can be passed to the service, and the
+// hex encoded public key, which has to be provisioned on the router.
+func GenerateCryptosignKey() (privateKey, publicKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(priv.Seed()), hex.EncodeToString(pub), nil
+}
+
+// writeCryptosignKey generates a new keypair, stores the private key in the given file and
+// returns the public key. Existing files are never overwritten.
+func writeCryptosignKey(fname string) (string, error) {
+	privateKey, publicKey, err := GenerateCryptosignKey()
+	if err != nil {
+		return "", newExitError(ExitService, "Failed to generate cryptosign key: %s", err)
+	}
+	file, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", newExitError(ExitArgument, "Failed to create cryptosign private key file: %s", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(privateKey + "\n"); err != nil {
+		return "", newExitError(ExitService, "Failed to write cryptosign private key: %s", err)
+	}
+	return publicKey, nil
+}
+
+// parseCryptosignKey decodes a hex encoded Ed25519 private key, either the 32 byte seed
+// or the full 64 byte private key.
+func parseCryptosignKey(key string) (ed25519.PrivateKey, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, newExitError(ExitArgument, "Failed to decode cryptosign private key: %s", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, newExitError(ExitArgument, "Cryptosign private key has invalid length %d", len(raw))
+}
+
+// loadCryptosignKey reads the private key from the given value or, if empty, from the given
+// file. It returns nil if neither is set.
+func loadCryptosignKey(key, fname string) (ed25519.PrivateKey, error) {
+	if key == "" && fname != "" {
+		if err := ensureFileExists("cryptosign private key", fname); err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, newExitError(ExitArgument, "Failed to load cryptosign private key: %s", err)
+		}
+		key = string(content)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	return parseCryptosignKey(key)
+}
+
+// cryptosignPublicKey returns the hex encoded public key that is sent in the authextra
+// hello details.
+func (srv *Service) cryptosignPublicKey() string {
+	return hex.EncodeToString(srv.cryptosignKey.Public().(ed25519.PublicKey))
+}
+
+// signCryptosignChallenge signs the hex encoded challenge sent by the router and returns the
+// hex encoded signature followed by the challenge.
+func (srv *Service) signCryptosignChallenge(c *wamp.Challenge) (string, wamp.Dict) {
+	challengeHex, _ := wamp.AsString(c.Extra["challenge"])
+	challenge, err := hex.DecodeString(challengeHex)
+	if err != nil {
+		srv.Logger.Errorf("Received invalid cryptosign challenge: %s", err)
+		return "", wamp.Dict{}
+	}
+	signature := ed25519.Sign(srv.cryptosignKey, challenge)
+	return hex.EncodeToString(signature) + challengeHex, wamp.Dict{}
+}
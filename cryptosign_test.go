@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gammazero/nexus/wamp"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestCryptosignKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "key")
+
+	publicKey, err := writeCryptosignKey(fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := writeCryptosignKey(fname); err == nil {
+		t.Error("Expected existing key file not to be overwritten")
+	}
+
+	srv := &Service{}
+	srv.cryptosignKey, err = loadCryptosignKey("", fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := srv.selectAuthMethod("", "service", ""); err != nil || srv.authMethod != authCryptosign {
+		t.Fatalf("Expected cryptosign authentication, got: %s (%v)", srv.authMethod, err)
+	}
+	extra, _ := wamp.AsDict(srv.helloDetails()["authextra"])
+	if extra["pubkey"] != publicKey {
+		t.Errorf("Expected pubkey '%s' in authextra, got: %v", publicKey, extra["pubkey"])
+	}
+
+	challenge := hex.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	signed, _ := srv.authHandlers()[authCryptosign](&wamp.Challenge{
+		AuthMethod: authCryptosign,
+		Extra:      wamp.Dict{"challenge": challenge},
+	})
+	raw, err := hex.DecodeString(signed)
+	if err != nil || len(raw) != ed25519.SignatureSize+32 {
+		t.Fatalf("Expected signature followed by challenge, got: %s", signed)
+	}
+	pub, _ := hex.DecodeString(publicKey)
+	if !ed25519.Verify(ed25519.PublicKey(pub), raw[ed25519.SignatureSize:], raw[:ed25519.SignatureSize]) {
+		t.Error("Expected valid signature")
+	}
+}
+
+func TestParseCryptosignKey(t *testing.T) {
+	if _, err := parseCryptosignKey("not hex"); err == nil {
+		t.Error("Expected error for invalid hex")
+	}
+	if _, err := parseCryptosignKey("abcd"); err == nil {
+		t.Error("Expected error for invalid key length")
+	}
+	if key, err := loadCryptosignKey("", ""); key != nil || err != nil {
+		t.Error("Expected no key without value and file")
+	}
+}
+
+func TestGenerateCryptosignKeyFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "new.key")
+
+	// the key file setting must not be taken as _FILE variant of the key
+	os.Setenv(EnvCryptosignKeyFile, fname)
+	defer os.Unsetenv(EnvCryptosignKeyFile)
+	_, err = NewE(Config{Name: "keygen", Args: []string{"--generate-cryptosign-key"}})
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitSuccess {
+		t.Fatalf("Expected key generation to succeed, got: %v", err)
+	}
+	if key, err := loadCryptosignKey("", fname); key == nil || err != nil {
+		t.Errorf("Expected a key to be written to %s, got: %v", fname, err)
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscoveryPrunesExpiredInstances(t *testing.T) {
+	d := &Discovery{instances: make(map[string]Instance)}
+	d.instances["crashed"] = Instance{
+		Name:       "worker",
+		InstanceID: "crashed",
+		LastSeen:   time.Now().Add(-time.Minute),
+		Interval:   time.Second,
+	}
+
+	d.handle(Announcement{Event: PresenceHeartbeat, Name: "worker", InstanceID: "running", Interval: 1})
+	if _, ok := d.instances["crashed"]; ok {
+		t.Error("Expected the expired instance to be removed")
+	}
+	if instances := d.Find("worker"); len(instances) != 1 || instances[0].InstanceID != "running" {
+		t.Errorf("Expected only the running instance, got: %+v", instances)
+	}
+}
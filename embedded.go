@@ -0,0 +1,109 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/gammazero/nexus/router"
+	"github.com/gammazero/nexus/wamp"
+	logging "github.com/op/go-logging"
+)
+
+// EnvEmbeddedRouter defines the environment variable name for the flag indicating
+// whether the service should start its own in-process router.
+const EnvEmbeddedRouter string = "SERVICE_EMBEDDED_ROUTER"
+
+// embeddedEndpoint is reported as endpoint when connected to an in-process router.
+const embeddedEndpoint = "local://"
+
+// routerLogger forwards the log output of the nexus router to the service logger.
+type routerLogger struct {
+	logger *logging.Logger
+}
+
+func (l routerLogger) Print(v ...interface{}) {
+	l.logger.Debug(fmt.Sprint(v...))
+}
+
+func (l routerLogger) Println(v ...interface{}) {
+	l.logger.Debug(fmt.Sprint(v...))
+}
+
+func (l routerLogger) Printf(format string, v ...interface{}) {
+	l.logger.Debugf(format, v...)
+}
+
+// NewRouter starts an in-process nexus router serving the given realm. The realm allows
+// anonymous authentication and discloses the caller of procedures and publishers of
+// events, so `ParseCallerID` and `ParsePublisherID` work as usual.
+//
+// The router can be shared by several services of the same process using `NewEmbedded`.
+func NewRouter(realm string) (router.Router, error) {
+	cfg := &router.Config{
+		RealmConfigs: []*router.RealmConfig{{
+			URI:           wamp.URI(realm),
+			AnonymousAuth: true,
+			AllowDisclose: true,
+		}},
+	}
+	r, err := router.NewRouter(cfg, routerLogger{logging.MustGetLogger("com.robulab.router")})
+	if err != nil {
+		return nil, newExitError(ExitService, "Failed to start embedded router: %s", err)
+	}
+	return r, nil
+}
+
+// NewEmbedded creates a new service instance which connects to an in-process router
+// instead of a broker. When no router is given, a new one serving the realm is started
+// and closed when the service stops. Use `Router` to attach further services to it.
+//
+// In contrast to `New` the command line and the environment are not evaluated, the
+// service uses the default settings without authentication and pings. Options are left
+// untouched.
+func NewEmbedded(defaultConfig Config, r router.Router, realm string) (*Service, error) {
+	if realm == "" {
+		return nil, newExitError(ExitArgument, "Please provide a realm!")
+	}
+
+	srv := newService(defaultConfig)
+	if err := setupLogger(srv); err != nil {
+		return nil, err
+	}
+	srv.realm = realm
+	if err := srv.useEmbeddedRouter(r); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// useEmbeddedRouter configures the service to connect to the given in-process router,
+// a new router is started when it is nil.
+func (srv *Service) useEmbeddedRouter(r router.Router) error {
+	if r == nil {
+		var err error
+		if r, err = NewRouter(srv.realm); err != nil {
+			return err
+		}
+		srv.ownsRouter = true
+	}
+	srv.router = r
+	srv.brokerURLs = []string{embeddedEndpoint}
+	// the embedded router neither requires authentication nor provides a ping procedure
+	srv.useAuth = false
+	srv.pingEnabled = false
+	return nil
+}
+
+// Router returns the in-process router the service is connected to, or nil when the
+// service connects to a broker.
+func (srv *Service) Router() router.Router {
+	return srv.router
+}
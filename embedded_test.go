@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestEmbeddedRouter(t *testing.T) {
+	callee, err := NewEmbedded(Config{Name: "callee"}, nil, "realm1")
+	if err != nil {
+		t.Fatalf("Failed to create embedded service: %s", err)
+	}
+	if callee.Router() == nil {
+		t.Fatal("Expected embedded router to be started")
+	}
+	defer callee.Router().Close()
+
+	caller, err := NewEmbedded(Config{Name: "caller"}, callee.Router(), "realm1")
+	if err != nil {
+		t.Fatalf("Failed to create embedded service: %s", err)
+	}
+
+	for _, srv := range []*Service{callee, caller} {
+		if err := srv.ConnectE(); err != nil {
+			t.Fatalf("Failed to connect to embedded router: %s", err)
+		}
+		defer srv.Client.Close()
+	}
+	if callee.Endpoint() != embeddedEndpoint {
+		t.Errorf("Expected endpoint %s, got: %s", embeddedEndpoint, callee.Endpoint())
+	}
+
+	if err := callee.RegisterAll(map[string]HandlerRegistration{
+		"test.echo": {
+			Handler: func(_ context.Context, args wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+				return ReturnValue(args[0])
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	result, err := caller.Client.Call(context.Background(), "test.echo", nil, wamp.List{"hello"}, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to call procedure: %s", err)
+	}
+	if len(result.Arguments) != 1 || result.Arguments[0] != "hello" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+}
@@ -0,0 +1,153 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// srvSuffix marks a broker url whose host is resolved using a DNS SRV lookup, e.g.
+// `wss+srv://_wamp._tcp.example.com/ws`.
+const srvSuffix = "+srv"
+
+// brokerSchemes lists the supported broker url schemes and whether they use TLS.
+// Websocket urls use the websocket transport, tcp, tcps and unix urls the rawsocket
+// transport of nexus.
+var brokerSchemes = map[string]bool{
+	"ws":   false,
+	"wss":  true,
+	"tcp":  false,
+	"tcps": true,
+	"unix": false,
+}
+
+// lookupSRV is used to resolve SRV broker urls, it is replaced in tests.
+var lookupSRV = net.LookupSRV
+
+// parseBrokerURLs splits a comma-separated list of broker urls and validates each of them.
+func parseBrokerURLs(urls string) ([]string, error) {
+	result := []string{}
+	for _, u := range strings.Split(urls, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, newExitError(ExitArgument, "Broker url '%s' is invalid: %s", u, err)
+		}
+		if _, ok := brokerSchemes[strings.TrimSuffix(parsed.Scheme, srvSuffix)]; !ok {
+			return nil, newExitError(ExitArgument, "Broker url '%s' has unsupported scheme '%s'", u, parsed.Scheme)
+		}
+		result = append(result, u)
+	}
+	if len(result) == 0 {
+		return nil, newExitError(ExitArgument, "Please provide a broker url!")
+	}
+	return result, nil
+}
+
+// isTLSURL checks whether the given broker url requires a TLS connection.
+func isTLSURL(u string) bool {
+	scheme := strings.SplitN(u, "://", 2)[0]
+	return brokerSchemes[strings.TrimSuffix(scheme, srvSuffix)]
+}
+
+// endpointHost returns the host name of the given broker url without the port.
+func endpointHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// resolveSRV replaces the host of a SRV broker url by the targets of the DNS SRV record,
+// ordered by priority and weight.
+func resolveSRV(u string) ([]string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	_, records, err := lookupSRV("", "", parsed.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, record := range records {
+		resolved := *parsed
+		resolved.Scheme = strings.TrimSuffix(parsed.Scheme, srvSuffix)
+		resolved.Host = net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		result = append(result, resolved.String())
+	}
+	return result, nil
+}
+
+// candidates resolves all broker urls and orders them by their health: endpoints with
+// fewer consecutive failures are tried first, the configured order is kept otherwise.
+func (srv *Service) candidates() []string {
+	result := []string{}
+	for _, u := range srv.brokerURLs {
+		scheme := strings.SplitN(u, "://", 2)[0]
+		if !strings.HasSuffix(scheme, srvSuffix) {
+			result = append(result, u)
+			continue
+		}
+		resolved, err := resolveSRV(u)
+		if err != nil {
+			srv.Logger.Warningf("Failed to resolve broker url '%s': %s", u, err)
+			continue
+		}
+		result = append(result, resolved...)
+	}
+
+	srv.endpointLock.Lock()
+	defer srv.endpointLock.Unlock()
+	sort.SliceStable(result, func(i, j int) bool {
+		return srv.endpointFailures[result[i]] < srv.endpointFailures[result[j]]
+	})
+	return result
+}
+
+// endpointFailed records a failed connection attempt to the given endpoint.
+func (srv *Service) endpointFailed(u string) {
+	srv.endpointLock.Lock()
+	defer srv.endpointLock.Unlock()
+	srv.endpointFailures[u]++
+}
+
+// endpointConnected records a successful connection to the given endpoint.
+func (srv *Service) endpointConnected(u string) {
+	srv.endpointLock.Lock()
+	defer srv.endpointLock.Unlock()
+	delete(srv.endpointFailures, u)
+	srv.endpoint = u
+}
+
+// Endpoint returns the url of the broker the service is currently connected to.
+func (srv *Service) Endpoint() string {
+	srv.endpointLock.Lock()
+	defer srv.endpointLock.Unlock()
+	return srv.endpoint
+}
+
+// requiresTLS checks whether any of the broker urls requires a TLS connection.
+func (srv *Service) requiresTLS() bool {
+	for _, u := range srv.brokerURLs {
+		if isTLSURL(u) {
+			return true
+		}
+	}
+	return false
+}
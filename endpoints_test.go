@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseBrokerURLs(t *testing.T) {
+	urls, err := parseBrokerURLs("ws://a:8080/ws, wss://b/ws,")
+	if err != nil {
+		t.Fatalf("Failed to parse broker urls: %s", err)
+	}
+	if !reflect.DeepEqual(urls, []string{"ws://a:8080/ws", "wss://b/ws"}) {
+		t.Errorf("Unexpected broker urls: %v", urls)
+	}
+	if _, err := parseBrokerURLs("wss+srv://_wamp._tcp.example.com/ws"); err != nil {
+		t.Errorf("Expected SRV url to be accepted, got: %s", err)
+	}
+	if _, err := parseBrokerURLs("tcp://a:8081,tcps://b:8082,unix:///run/nexus.sock"); err != nil {
+		t.Errorf("Expected rawsocket urls to be accepted, got: %s", err)
+	}
+	if _, err := parseBrokerURLs("ftp://a"); err == nil {
+		t.Error("Expected error for unsupported scheme")
+	}
+	if _, err := parseBrokerURLs(" , "); err == nil {
+		t.Error("Expected error for empty list")
+	}
+}
+
+func TestIsTLSURL(t *testing.T) {
+	if isTLSURL("ws://a/ws") {
+		t.Error("Expected ws:// to not use TLS")
+	}
+	if !isTLSURL("wss://a/ws") || !isTLSURL("wss+srv://a/ws") {
+		t.Error("Expected wss:// to use TLS")
+	}
+	if isTLSURL("tcp://a:8081") || isTLSURL("unix:///run/nexus.sock") {
+		t.Error("Expected tcp:// and unix:// to not use TLS")
+	}
+	if !isTLSURL("tcps://a:8082") {
+		t.Error("Expected tcps:// to use TLS")
+	}
+}
+
+func TestEndpointHost(t *testing.T) {
+	if h := endpointHost("tcps://broker.example.com:8082"); h != "broker.example.com" {
+		t.Errorf("Expected broker.example.com, got: %s", h)
+	}
+	if h := endpointHost("wss://[::1]:8080/ws"); h != "::1" {
+		t.Errorf("Expected ::1, got: %s", h)
+	}
+}
+
+func TestResolveSRV(t *testing.T) {
+	defer func(orig func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = orig }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_wamp._tcp.example.com" {
+			return "", nil, errors.New("no such host")
+		}
+		return "", []*net.SRV{
+			{Target: "a.example.com.", Port: 8080},
+			{Target: "b.example.com.", Port: 8443},
+		}, nil
+	}
+
+	urls, err := resolveSRV("wss+srv://_wamp._tcp.example.com/ws")
+	if err != nil {
+		t.Fatalf("Failed to resolve SRV url: %s", err)
+	}
+	expected := []string{"wss://a.example.com:8080/ws", "wss://b.example.com:8443/ws"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected %v, got: %v", expected, urls)
+	}
+	if _, err := resolveSRV("wss+srv://unknown/ws"); err == nil {
+		t.Error("Expected error for failed lookup")
+	}
+}
+
+func TestCandidatesOrder(t *testing.T) {
+	srv := &Service{
+		brokerURLs:       []string{"ws://a/ws", "ws://b/ws", "ws://c/ws"},
+		endpointFailures: make(map[string]int),
+	}
+	srv.endpointFailed("ws://a/ws")
+	srv.endpointFailed("ws://a/ws")
+	srv.endpointFailed("ws://b/ws")
+
+	expected := []string{"ws://c/ws", "ws://b/ws", "ws://a/ws"}
+	if c := srv.candidates(); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected %v, got: %v", expected, c)
+	}
+
+	srv.endpointConnected("ws://a/ws")
+	if srv.Endpoint() != "ws://a/ws" {
+		t.Errorf("Expected current endpoint to be updated, got: %s", srv.Endpoint())
+	}
+	expected = []string{"ws://a/ws", "ws://c/ws", "ws://b/ws"}
+	if c := srv.candidates(); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected %v, got: %v", expected, c)
+	}
+}
@@ -0,0 +1,143 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"errors"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// ErrInternal is the error URI returned to the caller when a handler panicked or failed
+// with an error which is not an `*Error`.
+const ErrInternal = "ee.error.internal"
+
+// errorURIPrefix is the common prefix of all error URIs of this library.
+const errorURIPrefix = "ee.error."
+
+// errorKindNames maps the error kinds to the last component of their error URI.
+var errorKindNames = map[ErrorKind]string{
+	ErrorBadArgument:            "bad_argument",
+	ErrorNotAvailable:           "not_available",
+	ErrorNotEnoughData:          "not_enough_data",
+	ErrorUnexpectedData:         "unexpected_data",
+	ErrorTooMuchData:            "too_much_data",
+	ErrorOutOfRange:             "out_of_range",
+	ErrorTimedOut:               "timed_out",
+	ErrorPermissionDenied:       "permission_denied",
+	ErrorNotFound:               "not_found",
+	ErrorUnreachableLineReached: "unreachable_line_reached",
+	ErrorThisWorksOnMyMachine:   "this_works_on_my_machine",
+	ErrorItsNotABugItsAFeature:  "its_not_a_bug_its_a_feature",
+	ErrorAKittenDies:            "a_kitten_dies",
+}
+
+// String returns the name of the error kind, e.g. `bad_argument`.
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// URI returns the canonical error URI of the error kind, e.g. `ee.error.bad_argument`.
+// Unknown kinds are mapped to `ErrInternal`.
+func (k ErrorKind) URI() string {
+	if name, ok := errorKindNames[k]; ok {
+		return errorURIPrefix + name
+	}
+	return ErrInternal
+}
+
+// errorKindFromURI looks up the error kind of the given error URI.
+func errorKindFromURI(uri wamp.URI) (ErrorKind, bool) {
+	for kind := range errorKindNames {
+		if kind.URI() == string(uri) {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+// internalErrorMessage is sent to the caller instead of the message of errors which are
+// not an `*Error`, as they may hold internal details.
+const internalErrorMessage = "internal error"
+
+// ReturnErr constructs a wamp response which contains the given error, an empty response
+// is returned when err is nil. An `*Error`, also when wrapped, is sent with the URI of its
+// kind, the full error message is passed as only argument and the keyword arguments `kind`,
+// `message` and `inner` hold its parts, next to its details. All other errors are sent as
+// `ErrInternal` with a generic message only, so log them before returning them.
+func ReturnErr(err error) *client.InvokeResult {
+	if err == nil {
+		return ReturnEmpty()
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		return &client.InvokeResult{
+			Err:    wamp.URI(ErrInternal),
+			Args:   wamp.List{internalErrorMessage},
+			Kwargs: wamp.Dict{"message": internalErrorMessage},
+		}
+	}
+
+	kwargs := wamp.Dict{}
+	for key, value := range e.Details {
+		kwargs[key] = value
+	}
+	kwargs["kind"] = e.kind.String()
+	kwargs["message"] = e.kind.message()
+	if e.inner != nil {
+		kwargs["inner"] = e.inner.Error()
+	}
+	return &client.InvokeResult{
+		Err:    wamp.URI(e.kind.URI()),
+		Args:   wamp.List{err.Error()},
+		Kwargs: kwargs,
+	}
+}
+
+// AsError reconstructs an `*Error` from an error returned by a wamp RPC call, which failed
+// with the URI of an error kind, e.g. using `ReturnErr`. The inner error only holds the
+// message of the original inner error, the remaining keyword arguments are restored as
+// details. The second return value is false when the error
+// can't be converted.
+func AsError(err error) (*Error, bool) {
+	switch e := err.(type) {
+	case *Error:
+		return e, true
+	case client.RPCError:
+		if e.Err == nil {
+			return nil, false
+		}
+		kind, ok := errorKindFromURI(e.Err.Error)
+		if !ok {
+			return nil, false
+		}
+		var inner error
+		if msg, ok := e.Err.ArgumentsKw["inner"].(string); ok && msg != "" {
+			inner = errors.New(msg)
+		}
+		result := NewErrorFrom(kind, inner)
+		for key, value := range e.Err.ArgumentsKw {
+			if key == "kind" || key == "message" || key == "inner" {
+				continue
+			}
+			if result.Details == nil {
+				result.Details = wamp.Dict{}
+			}
+			result.Details[key] = value
+		}
+		return result, true
+	}
+	return nil, false
+}
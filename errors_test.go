@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestErrorKindURI(t *testing.T) {
+	if uri := service.ErrorNotFound.URI(); uri != "ee.error.not_found" {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+	if uri := service.ErrorKind(-1).URI(); uri != service.ErrInternal {
+		t.Errorf("Expected unknown kind to map to %s, got: %s", service.ErrInternal, uri)
+	}
+}
+
+func TestReturnErr(t *testing.T) {
+	if result := service.ReturnErr(nil); result.Err != "" {
+		t.Errorf("Expected empty result, got: %v", result)
+	}
+
+	result := service.ReturnErr(service.NewErrorFrom(service.ErrorPermissionDenied, errors.New("inner")))
+	if result.Err != "ee.error.permission_denied" {
+		t.Errorf("Unexpected error URI: %s", result.Err)
+	}
+	if result.Kwargs["kind"] != "permission_denied" || result.Kwargs["inner"] != "inner" {
+		t.Errorf("Unexpected kwargs: %v", result.Kwargs)
+	}
+
+	result = service.ReturnErr(fmt.Errorf("load: %w", service.NewError(service.ErrorNotFound)))
+	if result.Err != "ee.error.not_found" || result.Kwargs["kind"] != "not_found" {
+		t.Errorf("Expected wrapped error to keep its kind, got: %v", result)
+	}
+
+	result = service.ReturnErr(errors.New("plain: /var/lib/db"))
+	if result.Err != service.ErrInternal || result.Args[0] != "internal error" || result.Kwargs["message"] != "internal error" {
+		t.Errorf("Expected internal details not to be returned, got: %v", result)
+	}
+}
+
+func TestAsError(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "errors"})
+
+	if err := srv.RegisterAll(map[string]service.HandlerRegistration{
+		"errors.fail": {Handler: func(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+			err := service.NewErrorFrom(service.ErrorOutOfRange, errors.New("index 3"))
+			err.Details = wamp.Dict{"index": 3}
+			return service.ReturnErr(err)
+		}},
+	}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	_, err := h.CallE("errors.fail", nil, nil)
+	e, ok := service.AsError(err)
+	if !ok {
+		t.Fatalf("Expected error to be converted, got: %v", err)
+	}
+	if e.Error() != service.NewErrorFrom(service.ErrorOutOfRange, errors.New("index 3")).Error() {
+		t.Errorf("Unexpected error: %s", e)
+	}
+	if e.Details["index"] != 3 {
+		t.Errorf("Expected details to be restored, got: %v", e.Details)
+	}
+
+	_, err = h.CallE("errors.unknown", nil, nil)
+	if _, ok := service.AsError(err); ok {
+		t.Error("Expected wamp errors not to be converted")
+	}
+	if _, ok := service.AsError(errors.New("plain")); ok {
+		t.Error("Expected plain errors not to be converted")
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	inner := errors.New("inner")
+	err := fmt.Errorf("wrapped: %w", service.NewErrorFrom(service.ErrorNotFound, inner))
+
+	if !errors.Is(err, service.NewError(service.ErrorNotFound)) {
+		t.Error("Expected error to be of kind ErrorNotFound")
+	}
+	if errors.Is(err, service.NewError(service.ErrorTimedOut)) {
+		t.Error("Expected error not to be of kind ErrorTimedOut")
+	}
+	if !errors.Is(err, inner) {
+		t.Error("Expected inner error to be unwrapped")
+	}
+
+	var e *service.Error
+	if !errors.As(err, &e) || e.Kind() != service.ErrorNotFound {
+		t.Errorf("Expected *service.Error, got: %v", e)
+	}
+}
+
+func TestRegistrationErrorUnwrap(t *testing.T) {
+	inner := errors.New("inner")
+	var err error = &service.RegistrationError{ProcedureName: "test.procedure", Inner: inner}
+	if !errors.Is(err, inner) || !strings.Contains(err.Error(), "test.procedure") {
+		t.Errorf("Unexpected registration error: %s", err)
+	}
+	err = &service.SubscriptionError{Topic: "test.topic", Inner: inner}
+	if !errors.Is(err, inner) || !strings.Contains(err.Error(), "test.topic") {
+		t.Errorf("Unexpected subscription error: %s", err)
+	}
+}
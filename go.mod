@@ -1,12 +1,14 @@
 module github.com/EmbeddedEnterprises/service
 
-go 1.12
+go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/gammazero/nexus v0.0.0-20190521044753-a7ad85508ec6
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/ogier/pflag v0.0.1
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/ugorji/go v1.1.7 // indirect
-	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
+	gopkg.in/yaml.v2 v2.2.2
 )
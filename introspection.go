@@ -0,0 +1,136 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/transport/serialize"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// EnvIntrospectionEnabled defines the environment variable name for the flag indicating
+// whether the introspection procedures should be registered.
+const EnvIntrospectionEnabled string = "SERVICE_ENABLE_INTROSPECTION"
+
+// EnvIntrospectionPrefix defines the environment variable name for the prefix of the
+// introspection procedures.
+const EnvIntrospectionPrefix string = "SERVICE_INTROSPECTION_PREFIX"
+
+// serializationNames maps the serialization types to their names.
+var serializationNames = map[serialize.Serialization]string{
+	serialize.JSON:    "json",
+	serialize.MSGPACK: "msgpack",
+	serialize.CBOR:    "cbor",
+}
+
+// introspectionURI returns the URI of the given introspection procedure of the service.
+func (srv *Service) introspectionURI(procedure string) string {
+	return srv.introspectionPrefix + "." + srv.name + "." + procedure
+}
+
+// instanceIntrospectionURI returns the URI of the given introspection procedure of this
+// service instance.
+func (srv *Service) instanceIntrospectionURI(procedure string) string {
+	return srv.introspectionPrefix + "." + srv.name + "." + srv.instanceID + "." + procedure
+}
+
+// registerIntrospection registers the `describe`, `version` and `health` procedures of
+// the service. The procedures `<prefix>.<name>.<procedure>` are shared between all
+// instances of the service, each call is answered by any of them. The procedures
+// `<prefix>.<name>.<instance_id>.<procedure>` are answered by the given instance only.
+func (srv *Service) registerIntrospection() *RegistrationError {
+	options := wamp.Dict{wamp.OptInvoke: wamp.InvokeRoundRobin}
+	return srv.RegisterAll(map[string]HandlerRegistration{
+		srv.introspectionURI("describe"):         {Handler: srv.describe, Options: options},
+		srv.introspectionURI("version"):          {Handler: srv.versionInfo, Options: options},
+		srv.introspectionURI("health"):           {Handler: srv.health, Options: options},
+		srv.instanceIntrospectionURI("describe"): {Handler: srv.describe},
+		srv.instanceIntrospectionURI("version"):  {Handler: srv.versionInfo},
+		srv.instanceIntrospectionURI("health"):   {Handler: srv.health},
+	})
+}
+
+// connectionInfo describes the connection of the service to the broker.
+func (srv *Service) connectionInfo() wamp.Dict {
+	authMethod := authAnonymous
+	if srv.useAuth {
+		authMethod = srv.authMethod
+	}
+	return wamp.Dict{
+		"endpoint":      srv.Endpoint(),
+		"realm":         srv.realm,
+		"serialization": serializationNames[srv.serialization],
+		"tls":           srv.useTLS,
+		"auth_method":   authMethod,
+		"auth_id":       srv.username,
+	}
+}
+
+// registrations returns the sorted names of the registered procedures and subscribed topics.
+func (srv *Service) registrations() (procedures, topics []string) {
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	procedures = make([]string, 0, len(srv.procedures))
+	for name := range srv.procedures {
+		procedures = append(procedures, name)
+	}
+	sort.Strings(procedures)
+	topics = make([]string, 0, len(srv.events))
+	for topic := range srv.events {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return procedures, topics
+}
+
+func (srv *Service) uptime() float64 {
+	return time.Since(srv.started).Seconds()
+}
+
+func (srv *Service) versionInfo(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+	return ReturnValue(wamp.Dict{
+		"name":            srv.name,
+		"version":         srv.version,
+		"instance_id":     srv.instanceID,
+		"library_version": Version,
+	})
+}
+
+func (srv *Service) health(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+	return ReturnValue(wamp.Dict{
+		"status":          "ok",
+		"instance_id":     srv.instanceID,
+		"uptime":          srv.uptime(),
+		"connection":      srv.connectionInfo(),
+		"panics":          srv.Panics(),
+		"decode_failures": srv.DecodeFailures(),
+	})
+}
+
+func (srv *Service) describe(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+	procedures, topics := srv.registrations()
+	return ReturnValue(wamp.Dict{
+		"name":            srv.name,
+		"version":         srv.version,
+		"description":     srv.description,
+		"instance_id":     srv.instanceID,
+		"library_version": Version,
+		"uptime":          srv.uptime(),
+		"procedures":      procedures,
+		"topics":          topics,
+		"spec":            srv.Spec(),
+		"connection":      srv.connectionInfo(),
+	})
+}
@@ -0,0 +1,52 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestIntrospection(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "inspected", Version: "1.2.3"})
+	if err := srv.RegisterFunc("inspected.echo", func(value string) string { return value }); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	version := h.Call(t, "ee.service.inspected.version", nil, nil).Arguments[0].(wamp.Dict)
+	if version["version"] != "1.2.3" || version["library_version"] != service.Version {
+		t.Errorf("Unexpected version info: %v", version)
+	}
+
+	health := h.Call(t, "ee.service.inspected.health", nil, nil).Arguments[0].(wamp.Dict)
+	if health["status"] != "ok" {
+		t.Errorf("Unexpected health info: %v", health)
+	}
+	if connection := health["connection"].(wamp.Dict); connection["realm"] != servicetest.Realm {
+		t.Errorf("Unexpected connection info: %v", connection)
+	}
+
+	describe := h.Call(t, "ee.service.inspected.describe", nil, nil).Arguments[0].(wamp.Dict)
+	found := false
+	for _, procedure := range describe["procedures"].([]string) {
+		found = found || procedure == "inspected.echo"
+	}
+	if !found || describe["name"] != "inspected" {
+		t.Errorf("Unexpected description: %v", describe)
+	}
+
+	// a second instance shares the introspection procedures, the instance specific ones
+	// are answered by the given instance only
+	other := h.Service(t, service.Config{Name: "inspected", Version: "1.2.3"})
+	for _, instance := range []*service.Service{srv, other} {
+		for i := 0; i < 2; i++ {
+			health := h.Call(t, "ee.service.inspected."+instance.InstanceID()+".health", nil, nil).Arguments[0].(wamp.Dict)
+			if health["instance_id"] != instance.InstanceID() {
+				t.Errorf("Expected health of instance %s, got: %v", instance.InstanceID(), health)
+			}
+		}
+	}
+}
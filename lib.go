@@ -15,21 +15,23 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net"
 	"os"
 	"os/signal"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/router"
 	"github.com/gammazero/nexus/transport/serialize"
 	"github.com/gammazero/nexus/wamp"
 	"github.com/mitchellh/mapstructure"
 	flag "github.com/ogier/pflag"
 	"github.com/op/go-logging"
+	"golang.org/x/crypto/ed25519"
 )
 
 // BinaryDataExtension is the extension number used to correctly encode raw binary
@@ -68,6 +70,45 @@ const (
 	ExitRegistration
 )
 
+// ExitError is returned by the error-returning variants of the service API, e.g. `NewE`,
+// `ConnectE` and `RunE`. It holds the exit code the program would have terminated with
+// and the inner error describing what went wrong.
+type ExitError struct {
+	Code  int
+	Inner error
+}
+
+func newExitError(code int, format string, args ...interface{}) *ExitError {
+	return &ExitError{
+		Code:  code,
+		Inner: fmt.Errorf(format, args...),
+	}
+}
+
+func (e *ExitError) Error() string {
+	return e.Inner.Error()
+}
+
+// Unwrap returns the inner error.
+func (e *ExitError) Unwrap() error {
+	return e.Inner
+}
+
+// exitOnError terminates the program with the exit code carried by err, if err is not nil.
+func exitOnError(logger *logging.Logger, err error) {
+	if err == nil {
+		return
+	}
+	code := ExitService
+	if exitErr, ok := err.(*ExitError); ok {
+		code = exitErr.Code
+	}
+	if code != ExitSuccess {
+		logger.Critical(err.Error())
+	}
+	os.Exit(code)
+}
+
 // EnvUsername defines the environment variable name for the username the service is using
 // to authenticate on the broker.
 const EnvUsername string = "SERVICE_USERNAME"
@@ -77,6 +118,7 @@ const EnvUsername string = "SERVICE_USERNAME"
 const EnvPassword string = "SERVICE_PASSWORD"
 
 // EnvLogFormat defines the environment variable name for the logging format string definition.
+// Supported formats are "human" (default), "k8s" and "json".
 const EnvLogFormat string = "SERVICE_LOGFORMAT"
 
 // EnvBrokerURL defines the environment variable name for the broker url definition.
@@ -110,6 +152,22 @@ const EnvPingInterval string = "SERVICE_PING_INTERVAL"
 // EnvPingEndpoint defines the environment variable name for the ping procedure to call
 const EnvPingEndpoint string = "SERVICE_PING_ENDPOINT"
 
+// EnvReconnectEnabled defines the environment variable name for the flag indicating
+// whether the service should reconnect to the broker after the connection was lost
+const EnvReconnectEnabled string = "SERVICE_ENABLE_RECONNECT"
+
+// EnvReconnectMaxInterval defines the environment variable name for the maximum backoff
+// duration between two reconnect attempts
+const EnvReconnectMaxInterval string = "SERVICE_RECONNECT_MAX_INTERVAL"
+
+// EnvReconnectAttempts defines the environment variable name for the number of connection
+// attempts before giving up, 0 means retry forever
+const EnvReconnectAttempts string = "SERVICE_RECONNECT_ATTEMPTS"
+
+// EnvDrainTimeout defines the environment variable name for the maximum duration to wait
+// for running invocations to finish on shutdown
+const EnvDrainTimeout string = "SERVICE_DRAIN_TIMEOUT"
+
 // Version defines the git tag this code is built with
 const Version string = "0.18.0"
 
@@ -117,49 +175,133 @@ const Version string = "0.18.0"
 // An instance of this struct is the main object that is used to communicate with the
 // broker backend. Use the `New` function to create a service instance. The instance will
 // give you access to the `Logger` and `Client` object.
+//
+// The `Client` object is replaced when the service reconnects to the broker, so don't keep
+// a copy of it around for longer than a single call. Use `CurrentClient` to access it while
+// the service is running.
 type Service struct {
-	name          string
-	serialization serialize.Serialization
-	realm         string
-	url           string
-	username      string
-	password      string
-	pingEnabled   bool
-	pingInterval  time.Duration
-	pingEndpoint  string
-	useAuth       bool
-	useTLS        bool
-	serverCert    *x509.CertPool
-	clientCert    *tls.Certificate
-	Logger        *logging.Logger
-	Client        *client.Client
-	timeout       time.Duration
+	// fields accessed atomically come first, so the counters are 64-bit aligned on 32-bit
+	// platforms
+	decodeFailures uint64
+	panics         uint64
+	presenceJoined uint32
+
+	name                      string
+	version                   string
+	description               string
+	serialization             serialize.Serialization
+	realm                     string
+	brokerURLs                []string
+	router                    router.Router
+	ownsRouter                bool
+	endpoint                  string
+	endpointFailures          map[string]int
+	endpointLock              sync.Mutex
+	username                  string
+	password                  string
+	pingEnabled               bool
+	pingInterval              time.Duration
+	pingEndpoint              string
+	reconnectEnabled          bool
+	reconnectMaxInterval      time.Duration
+	reconnectAttempts         int
+	drainTimeout              time.Duration
+	introspectionEnabled      bool
+	introspectionPrefix       string
+	started                   time.Time
+	instanceID                string
+	host                      string
+	presenceEnabled           bool
+	presenceInterval          time.Duration
+	presenceLock              sync.Mutex
+	presenceProcedures        []string
+	useAuth                   bool
+	authMethod                string
+	cryptosignKey             ed25519.PrivateKey
+	useTLS                    bool
+	tlsInsecure               bool
+	tlsMinVersion             uint16
+	tlsServerName             string
+	tlsPins                   [][]byte
+	credentialsLock           sync.RWMutex
+	credentialFiles           map[string]time.Time
+	credentialsReloadInterval time.Duration
+	serverCert                *x509.CertPool
+	serverCertFile            string
+	clientCert                *tls.Certificate
+	clientCertFile            string
+	clientKeyFile             string
+	passwordFile              string
+	Logger                    *logging.Logger
+	Client                    *client.Client
+	clientLock                sync.RWMutex
+	timeout                   time.Duration
+	registryLock              sync.Mutex
+	interceptors              []Interceptor
+	spec                      ServiceSpec
+	specLock                  sync.Mutex
+	interceptorsLock          sync.RWMutex
+	inflightLock              sync.Mutex
+	inflight                  int
+	draining                  bool
+	drained                   chan struct{}
+	procedures                map[string]HandlerRegistration
+	events                    map[string]EventSubscription
 }
 
 // Config is a structure describing the service. It is used to describe the service
 // when running with --version or --help.
 // Values passed in the config structure can't be overridden at runtime.
+//
+// Options may point to a struct holding service specific options. A command line flag,
+// environment variable and configuration file key is generated for each of its exported
+// fields, the values present in the struct are used as defaults. The options are parsed
+// and validated together with the settings of the service library. The following struct
+// tags are supported:
+//
+// `flag:"name"` overrides the flag name, which defaults to the kebab-cased field name.
+// Use `flag:"-"` to skip a field.
+//
+// `env:"NAME"` overrides the environment variable, which defaults to `SERVICE_` followed
+// by the upper-cased flag name.
+//
+// `usage:"text"` sets the help text of the flag.
+//
+// `required:"true"` fails the validation when the option has its zero value.
+//
+// `secret:"true"` redacts the value when the configuration is printed.
+//
+// Supported field types are strings, bools, numbers, `time.Duration` and `[]string`, which
+// is parsed from a comma-separated list. Implement `OptionsValidator` for further checks.
+//
+// SecretProvider is consulted for secret settings, like the password, which were neither
+// provided on the command line, the environment nor the configuration file.
+//
+// Args are the command line arguments to parse. When nil, `os.Args[1:]` is parsed and
+// flags the service defined on the global pflag set are accepted as well.
 type Config struct {
-	Name          string
-	Version       string
-	Description   string
-	Serialization serialize.Serialization
+	Name           string
+	Version        string
+	Description    string
+	Serialization  serialize.Serialization
+	Options        interface{}
+	SecretProvider SecretProvider
+	Args           []string
 }
 
-func ensureFileExists(fid, fname string, srv *Service) {
+func ensureFileExists(fid, fname string) error {
 	if _, err := os.Stat(fname); os.IsNotExist(err) {
-		srv.Logger.Errorf("Error validating %s: file %s doesn't exist! Exiting.\n", fid, fname)
-		os.Exit(ExitArgument)
+		return newExitError(ExitArgument, "Error validating %s: file %s doesn't exist!", fid, fname)
 	}
+	return nil
 }
 
-func setupLogger(srv *Service) {
+func setupLogger(srv *Service) error {
 	// setup logging library
 	var err error
-	srv.Logger, err = logging.GetLogger("com.robulab." + srv.name)
+	srv.Logger, err = logging.GetLogger(loggerName(srv.name))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating logger: %s\n", err)
-		os.Exit(ExitService)
+		return newExitError(ExitService, "Error creating logger: %s", err)
 	}
 
 	// write to Stderr to keep Stdout free for data output
@@ -168,6 +310,7 @@ func setupLogger(srv *Service) {
 	// read an environment variable controlling the log format
 	// possibilities are "k8s" or "cluster" or "machine" for a machine readable format
 	// and "debug" or "human" for a human readable format (default)
+	// "json" writes one JSON object per line for log pipelines
 	// the values are case insensitive
 	var logFormat logging.Formatter
 	envLogFormat := strings.ToLower(os.Getenv(EnvLogFormat))
@@ -176,17 +319,62 @@ func setupLogger(srv *Service) {
 		logFormat, err = logging.NewStringFormatter(`%{color}[%{level:-8s}] %{time:15:04:05.000} %{longpkg}@%{shortfile}%{color:reset} -- %{message}`)
 	case "k8s", "cluster", "machine":
 		logFormat, err = logging.NewStringFormatter(`[%{level:-8s}] %{time:2006-01-02T15:04:05.000} %{shortfunc} -- %{message}`)
+	case "json":
+		jsonLog.register(srv)
+		logging.SetBackend(jsonLog)
+		return nil
 	default:
-		fmt.Fprintf(os.Stderr, "Failed to setup log format: invalid format %s", envLogFormat)
-		os.Exit(ExitArgument)
+		return newExitError(ExitArgument, "Failed to setup log format: invalid format %s", envLogFormat)
 	}
 	if err != nil {
-		srv.Logger.Criticalf("Failed to create logging format, shutting down: %s", err)
-		os.Exit(ExitArgument)
+		return newExitError(ExitArgument, "Failed to create logging format, shutting down: %s", err)
 	}
 
 	backendFormatted := logging.NewBackendFormatter(backend, logFormat)
 	logging.SetBackend(backendFormatted)
+	return nil
+}
+
+func loggerName(name string) string {
+	if name == "" {
+		name = "example"
+	}
+	return "com.robulab." + name
+}
+
+// newService creates a service object holding the given configuration and the default
+// settings.
+func newService(defaultConfig Config) *Service {
+	name := defaultConfig.Name
+	if name == "" {
+		name = "example"
+	}
+
+	srv := &Service{}
+	srv.name = name
+	srv.version = defaultConfig.Version
+	srv.description = defaultConfig.Description
+	srv.serialization = defaultConfig.Serialization
+	srv.pingEnabled = true
+	srv.pingEndpoint = "ee.ping"
+	srv.pingInterval = 10 * time.Second
+	srv.reconnectEnabled = true
+	srv.reconnectMaxInterval = 30 * time.Second
+	srv.reconnectAttempts = 0
+	srv.drainTimeout = 10 * time.Second
+	srv.credentialsReloadInterval = 1 * time.Minute
+	srv.introspectionEnabled = true
+	srv.introspectionPrefix = "ee.service"
+	srv.started = time.Now()
+	srv.instanceID = newInstanceID()
+	srv.host, _ = os.Hostname()
+	srv.presenceEnabled = true
+	srv.presenceInterval = 30 * time.Second
+	srv.timeout = 5 * time.Second
+	srv.endpointFailures = make(map[string]int)
+	srv.procedures = make(map[string]HandlerRegistration)
+	srv.events = make(map[string]EventSubscription)
+	return srv
 }
 
 // New creates a new service instance from the provided default configuration.
@@ -201,77 +389,181 @@ func setupLogger(srv *Service) {
 // 2. An error occurred while parsing the command line arguments.
 //
 // 3. An internal error occurrs that cannot be recovered.
+//
+// Use `NewE` if you don't want the program to exit.
 func New(defaultConfig Config) *Service {
+	srv, err := NewE(defaultConfig)
+	exitOnError(logging.MustGetLogger(loggerName(defaultConfig.Name)), err)
+	return srv
+}
+
+// NewE creates a new service instance just like `New`, but returns an `*ExitError`
+// instead of exiting the program. When a version print or the help message was requested
+// the returned error carries the `ExitSuccess` code.
+func NewE(defaultConfig Config) (*Service, error) {
+	// every call uses its own flag set, so services can be created several times per process
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
 	// additional usage information
-	flag.Usage = func() {
+	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [OPTION]...\n\n%s\n\nOptions:\n", os.Args[0], defaultConfig.Description)
 		fmt.Fprintln(os.Stderr, "  -h, --help\n    \tprint this help message")
-		flag.PrintDefaults()
+		flags.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n%s copyright © 2017-2018  EmbeddedEnterprises\n", defaultConfig.Name)
 	}
 
-	//default values for service name, serialization, websocket URL and realm
-	name := defaultConfig.Name
-	if name == "" {
-		name = "example"
+	// build the command line interface, allow to override the values provided by the environment
+	// and the configuration file
+	opts := newSettings(flags)
+	var cliVer = flags.BoolP("version", "V", false, "prints the version")
+	var cliCfg = flags.StringP("config", "c", os.Getenv(EnvConfigFile), "configuration file (YAML, TOML or JSON) providing default values")
+	var cliPrintCfg = flags.Bool("print-config", false, "prints the effective configuration")
+	var cliGenKey = flags.Bool("generate-cryptosign-key", false, "generates a new cryptosign private key in --cryptosign-key-file and prints the public key")
+	cliEmbedded, err := opts.Bool("embedded-router", EnvEmbeddedRouter, false, "start an in-process router serving the realm instead of connecting to a broker")
+	if err != nil {
+		return nil, err
 	}
+	var cliURL = opts.String("broker-url", "b", EnvBrokerURL, "comma-separated list of broker urls (ws, wss, tcp, tcps or unix), append +srv to the scheme for a DNS SRV lookup")
+	var cliUsr = opts.String("user", "u", EnvUsername, "the user to login as")
+	cliPwd, err := opts.Secret("password", "p", EnvPassword, "the password to login with")
+	if err != nil {
+		return nil, err
+	}
+	var cliRlm = opts.String("realm", "r", EnvRealm, "the name of the realm to connect to")
+	var cliAuth = opts.String("auth-method", "", EnvAuthMethod, "the authentication method (anonymous, ticket, wampcra, cryptosign or tls), derived from the credentials if empty")
+	// the key file is defined first, so its environment variable is not taken as _FILE
+	// variant of the key
+	var cliCSKF = opts.String("cryptosign-key-file", "", EnvCryptosignKeyFile, "file containing the hex encoded Ed25519 private key for cryptosign authentication")
+	cliCSK, err := opts.Secret("cryptosign-key", "", EnvCryptosignKey, "hex encoded Ed25519 private key for cryptosign authentication")
+	if err != nil {
+		return nil, err
+	}
+	var cliCCF = opts.String("tls-client-cert-file", "", EnvTLSClientCertFile, "TLS client public key file")
+	var cliCKF = opts.String("tls-client-key-file", "", EnvTLSClientKeyFile, "TLS client private key file")
+	var cliSCF = opts.String("tls-server-cert-file", "", EnvTLSServerCertFile, "TLS server public key file")
+	var cliTimeout = opts.String("connect-timeout", "", EnvConnectTimeout, "Timeout for broker connection, 0s to use default")
+	cliTLSInsecure, err := opts.Bool("tls-insecure", EnvTLSInsecure, false, "Disable the verification of the server certificate (insecure!)")
+	if err != nil {
+		return nil, err
+	}
+	var cliTLSMinVersion = opts.String("tls-min-version", "", EnvTLSMinVersion, "Minimum TLS version to accept (1.0, 1.1, 1.2 or 1.3), defaults to 1.2")
+	var cliTLSServerName = opts.String("tls-server-name", "", EnvTLSServerName, "Server name to send via SNI and to verify the server certificate against")
+	var cliTLSPins = opts.String("tls-pin-sha256", "", EnvTLSPins, "Comma-separated base64 SHA-256 hashes of trusted server public keys")
 
-	// build the command line interface, allow to override the values provided by the environment
-	var cliVer = flag.BoolP("version", "V", false, "prints the version")
-	var cliURL = flag.StringP("broker-url", "b", os.Getenv(EnvBrokerURL), "the websocket url of the broker")
-	var cliUsr = flag.StringP("user", "u", os.Getenv(EnvUsername), "the user to login as")
-	var cliPwd = flag.StringP("password", "p", os.Getenv(EnvPassword), "the password to login with")
-	var cliRlm = flag.StringP("realm", "r", os.Getenv(EnvRealm), "the name of the realm to connect to")
-	var cliCCF = flag.String("tls-client-cert-file", os.Getenv(EnvTLSClientCertFile), "TLS client public key file")
-	var cliCKF = flag.String("tls-client-key-file", os.Getenv(EnvTLSClientKeyFile), "TLS client private key file")
-	var cliSCF = flag.String("tls-server-cert-file", os.Getenv(EnvTLSServerCertFile), "TLS server public key file")
-	var cliTimeout = flag.String("connect-timeout", os.Getenv(EnvConnectTimeout), "Timeout for broker connection, 0s to use default")
-
-	enablePing := true
-
-	if enablePingVal, enablePingSet := os.LookupEnv(EnvPingEnabled); enablePingSet {
-		enable, err := strconv.ParseBool(enablePingVal)
+	pingEnable, err := opts.Bool("ping-enable", EnvPingEnabled, true, "Whether to send a ping to the server")
+	if err != nil {
+		return nil, err
+	}
+	var pingEndpoint = opts.String("ping-endpoint", "", EnvPingEndpoint, "Which procedure to call when pinging the server")
+	var pingInterval = opts.String("ping-interval", "", EnvPingInterval, "Duration between two pings")
+
+	reconnectEnable, err := opts.Bool("reconnect-enable", EnvReconnectEnabled, true, "Whether to reconnect to the broker when the connection was lost")
+	if err != nil {
+		return nil, err
+	}
+	var reconnectMaxInterval = opts.String("reconnect-max-interval", "", EnvReconnectMaxInterval, "Maximum duration to wait between two connection attempts")
+	var reconnectAttempts = opts.String("reconnect-attempts", "", EnvReconnectAttempts, "Number of connection attempts before giving up, 0 to retry forever")
+	var drainTimeout = opts.String("drain-timeout", "", EnvDrainTimeout, "Maximum duration to wait for running invocations on shutdown")
+	var credentialsReloadInterval = opts.String("credentials-reload-interval", "", EnvCredentialsReloadInterval, "Interval to check the TLS and password files for changes, 0s to disable")
+	introspectionEnable, err := opts.Bool("introspection-enable", EnvIntrospectionEnabled, true, "Whether to register the describe, version and health procedures")
+	if err != nil {
+		return nil, err
+	}
+	var introspectionPrefix = opts.String("introspection-prefix", "", EnvIntrospectionPrefix, "Prefix of the introspection procedures <prefix>.<name>.describe")
+	presenceEnable, err := opts.Bool("presence-enable", EnvPresenceEnabled, true, "Whether to announce the presence of the service")
+	if err != nil {
+		return nil, err
+	}
+	var presenceInterval = opts.String("presence-interval", "", EnvPresenceInterval, "Duration between two presence heartbeats")
+
+	// add the service specific options
+	if defaultConfig.Options != nil {
+		if err := registerOptions(opts, defaultConfig.Options); err != nil {
+			return nil, err
+		}
+	}
+
+	// parse the command line, flags defined on the global flag set by the service are parsed
+	// along with the own ones
+	args := defaultConfig.Args
+	if args == nil {
+		args = os.Args[1:]
+		mergeFlags(flags, flag.CommandLine)
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil, &ExitError{Code: ExitSuccess, Inner: err}
+	} else if err != nil {
+		return nil, &ExitError{Code: ExitArgument, Inner: err}
+	}
+
+	// fill in the values from the configuration file which were not provided otherwise
+	if *cliCfg != "" {
+		values, err := loadConfigFile(*cliCfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := opts.Apply(values); err != nil {
+			return nil, err
+		}
+	}
+
+	// ask the secret provider for all secrets which were not provided otherwise
+	if defaultConfig.SecretProvider != nil {
+		if err := opts.Resolve(defaultConfig.SecretProvider); err != nil {
+			return nil, err
+		}
+	}
+
+	// generate a keypair for cryptosign authentication
+	if *cliGenKey {
+		if *cliCSKF == "" {
+			return nil, newExitError(ExitArgument, "Please provide a --cryptosign-key-file to store the private key!")
+		}
+		publicKey, err := writeCryptosignKey(*cliCSKF)
 		if err != nil {
-			fmt.Printf("Failed to parse %s environment variable: %v", EnvPingEnabled, err)
-			os.Exit(ExitArgument)
+			return nil, err
 		}
-		enablePing = enable
+		fmt.Println(publicKey)
+		return nil, newExitError(ExitSuccess, "cryptosign key generated")
 	}
 
-	var pingEnable = flag.Bool("ping-enable", enablePing, "Whether to send a ping to the server")
-	var pingEndpoint = flag.String("ping-endpoint", os.Getenv(EnvPingEndpoint), "Which procedure to call when pinging the server")
-	var pingInterval = flag.String("ping-interval", os.Getenv(EnvPingInterval), "Duration between two pings")
-	// parse the command line
-	flag.Parse()
+	// display the effective configuration
+	if *cliPrintCfg {
+		if err := opts.Print(os.Stdout); err != nil {
+			return nil, newExitError(ExitService, "Failed to print configuration: %s", err)
+		}
+		return nil, newExitError(ExitSuccess, "configuration requested")
+	}
 
 	// display version information
 	if *cliVer {
 		fmt.Printf("Version (%-20s): %s\n", "service-lib", Version)
 		fmt.Printf("Version (%-20s): %s\n", defaultConfig.Name, defaultConfig.Version)
-		os.Exit(ExitSuccess)
+		return nil, newExitError(ExitSuccess, "version requested")
 	}
 
 	// create a new service object on the heap
-	srv := &Service{}
-	srv.name = name
-	srv.pingEnabled = true
-	srv.pingEndpoint = "ee.ping"
-	srv.pingInterval = 10 * time.Second
-	srv.timeout = 5 * time.Second
+	srv := newService(defaultConfig)
 
-	setupLogger(srv)
-	srv.serialization = defaultConfig.Serialization
+	if err := setupLogger(srv); err != nil {
+		return nil, err
+	}
 
-	if *cliURL == "" {
-		srv.Logger.Error("Please provide a broker url!")
-		flag.Usage()
-		os.Exit(ExitArgument)
+	if *cliURL == "" && !*cliEmbedded {
+		flags.Usage()
+		return nil, newExitError(ExitArgument, "Please provide a broker url!")
 	}
 
 	if *cliRlm == "" {
-		srv.Logger.Error("Please provide a realm!")
-		flag.Usage()
-		os.Exit(ExitArgument)
+		flags.Usage()
+		return nil, newExitError(ExitArgument, "Please provide a realm!")
+	}
+
+	if defaultConfig.Options != nil {
+		if err := validateOptions(defaultConfig.Options); err != nil {
+			flags.Usage()
+			return nil, err
+		}
 	}
 
 	if !*pingEnable {
@@ -283,23 +575,96 @@ func New(defaultConfig Config) *Service {
 
 	if *pingInterval != "" {
 		if pingIntervalDur, err := time.ParseDuration(*pingInterval); err != nil || pingIntervalDur < 1*time.Second {
-			srv.Logger.Errorf("Ping interval '%s' is invalid: %v", *pingInterval, err)
-			flag.Usage()
-			os.Exit(ExitArgument)
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Ping interval '%s' is invalid: %v", *pingInterval, err)
 		} else {
 			srv.pingInterval = pingIntervalDur
 		}
 	}
 
+	if !*reconnectEnable {
+		srv.reconnectEnabled = false
+	}
+
+	if *reconnectMaxInterval != "" {
+		if maxInterval, err := time.ParseDuration(*reconnectMaxInterval); err != nil || maxInterval < 1*time.Second {
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Reconnect interval '%s' is invalid: %v", *reconnectMaxInterval, err)
+		} else {
+			srv.reconnectMaxInterval = maxInterval
+		}
+	}
+
+	if *reconnectAttempts != "" {
+		if attempts, err := strconv.Atoi(*reconnectAttempts); err != nil || attempts < 0 {
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Reconnect attempts '%s' is invalid: %v", *reconnectAttempts, err)
+		} else {
+			srv.reconnectAttempts = attempts
+		}
+	}
+
+	if *drainTimeout != "" {
+		if timeout, err := time.ParseDuration(*drainTimeout); err != nil || timeout < 0 {
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Drain timeout '%s' is invalid: %v", *drainTimeout, err)
+		} else {
+			srv.drainTimeout = timeout
+		}
+	}
+
+	if !*introspectionEnable {
+		srv.introspectionEnabled = false
+	}
+	if *introspectionPrefix != "" {
+		srv.introspectionPrefix = *introspectionPrefix
+	}
+
+	if !*presenceEnable {
+		srv.presenceEnabled = false
+	}
+
+	if *presenceInterval != "" {
+		if interval, err := time.ParseDuration(*presenceInterval); err != nil || interval < 1*time.Second {
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Presence interval '%s' is invalid: %v", *presenceInterval, err)
+		} else {
+			srv.presenceInterval = interval
+		}
+	}
+
+	if *credentialsReloadInterval != "" {
+		if interval, err := time.ParseDuration(*credentialsReloadInterval); err != nil || interval < 0 {
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Credentials reload interval '%s' is invalid: %v", *credentialsReloadInterval, err)
+		} else {
+			srv.credentialsReloadInterval = interval
+		}
+	}
+
 	// setup the final values to use for this service
-	srv.url = *cliURL
 	srv.realm = *cliRlm
+	if *cliEmbedded {
+		if *cliURL != "" {
+			srv.Logger.Warning("Embedded router requested, ignoring the broker url")
+		}
+		if err := srv.useEmbeddedRouter(nil); err != nil {
+			return nil, err
+		}
+		srv.Logger.Info("Hello")
+		srv.Logger.Infof("Using an embedded router serving realm '%s'...", srv.realm)
+		return srv, nil
+	}
+	srv.brokerURLs, err = parseBrokerURLs(*cliURL)
+	if err != nil {
+		flags.Usage()
+		return nil, err
+	}
 	if *cliTimeout != "" {
 		timeout, err := time.ParseDuration(*cliTimeout)
 		if err != nil {
-			srv.Logger.Errorf("Specified timeout '%s' is invalid!", *cliTimeout)
-			flag.Usage()
-			os.Exit(ExitArgument)
+			flags.Usage()
+			return nil, newExitError(ExitArgument, "Specified timeout '%s' is invalid!", *cliTimeout)
 		}
 		if timeout != 0 && timeout < 1*time.Second {
 			srv.Logger.Info("Setting timeout to '1s', specifed duration was too short")
@@ -310,36 +675,51 @@ func New(defaultConfig Config) *Service {
 
 	srv.useAuth = true
 
-	// when wss:// is set, we are using TLS to secure the connection.
-	if strings.HasPrefix(srv.url, "wss://") {
+	srv.cryptosignKey, err = loadCryptosignKey(*cliCSK, *cliCSKF)
+	if err != nil {
+		return nil, err
+	}
+
+	// when a wss:// or tcps:// url is set, we are using TLS to secure the connection.
+	if srv.requiresTLS() {
 		srv.useTLS = true
 
+		srv.tlsInsecure = *cliTLSInsecure
+		if srv.tlsInsecure {
+			srv.Logger.Warning("TLS verification disabled, the identity of the broker is not checked!")
+		}
+		srv.tlsServerName = *cliTLSServerName
+		srv.tlsMinVersion, err = parseTLSVersion(*cliTLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		srv.tlsPins, err = parseTLSPins(*cliTLSPins)
+		if err != nil {
+			return nil, err
+		}
+
 		// Check whether the user requested to validate the servers identity
 		// If so, check the file exists and is a valid certificate
 		if *cliSCF == "" {
-			srv.Logger.Warning("Server Certificate/CA not set, disabling verification!")
+			srv.Logger.Info("Server Certificate/CA not set, using the system roots")
 			srv.serverCert = nil
 		} else {
-			ensureFileExists("TLS server public key", *cliSCF, srv)
-			srv.serverCert = x509.NewCertPool()
-			certPEM, err := ioutil.ReadFile(*cliSCF)
+			srv.serverCert, err = loadServerCert(*cliSCF)
 			if err != nil {
-				srv.Logger.Errorf("Failed to load TLS server public key: %s", err)
-				os.Exit(ExitArgument)
-			}
-			if !srv.serverCert.AppendCertsFromPEM(certPEM) {
-				srv.Logger.Error("Failed to import server certificate/CA to trust!")
-				os.Exit(ExitArgument)
+				return nil, err
 			}
+			srv.serverCertFile = *cliSCF
+			srv.watchCredentials(*cliSCF)
 		}
 
 		// Check whether the user requested to authenticate the service using TLS client certificates
 		// If so, check the certificates exist and are valid
 		if *cliCCF == "" || *cliCKF == "" {
-			// Otherwise, fallback to username/password
-			srv.Logger.Info("TLS client certificate not provided, falling back to ticket auth")
+			// Otherwise, fallback to username/password or cryptosign, the method actually
+			// used is logged once it is selected below
+			srv.Logger.Info("TLS client certificate not provided")
 			srv.clientCert = nil
-			if *cliUsr == "" || *cliPwd == "" {
+			if (*cliUsr == "" || *cliPwd == "") && srv.cryptosignKey == nil {
 				// Fallback to anonymous
 				srv.Logger.Warning("Missing username/password, disabling authentication completely.")
 				srv.useAuth = false
@@ -347,15 +727,14 @@ func New(defaultConfig Config) *Service {
 			srv.username = *cliUsr
 			srv.password = *cliPwd
 		} else {
-			ensureFileExists("TLS client public key", *cliCCF, srv)
-			ensureFileExists("TLS client private key", *cliCKF, srv)
 			srv.Logger.Info("Loading TLS client certificate")
-			cert, err := tls.LoadX509KeyPair(*cliCCF, *cliCKF)
+			srv.clientCert, err = loadClientCert(*cliCCF, *cliCKF)
 			if err != nil {
-				srv.Logger.Errorf("Failed to load TLS client certificate: %s", err)
-				os.Exit(ExitArgument)
+				return nil, err
 			}
-			srv.clientCert = &cert
+			srv.clientCertFile = *cliCCF
+			srv.clientKeyFile = *cliCKF
+			srv.watchCredentials(*cliCCF, *cliCKF)
 		}
 	} else {
 		// We are not running against a TLS secured endpoint, so print a warning if a client certificate
@@ -365,7 +744,7 @@ func New(defaultConfig Config) *Service {
 		}
 
 		// Check for regular ticket authentication.
-		if *cliUsr == "" || *cliPwd == "" {
+		if (*cliUsr == "" || *cliPwd == "") && srv.cryptosignKey == nil {
 			srv.Logger.Warning("Missing username/password, disabling authentication completely.")
 			srv.useAuth = false
 		}
@@ -373,48 +752,111 @@ func New(defaultConfig Config) *Service {
 		srv.password = *cliPwd
 	}
 
+	if err := srv.selectAuthMethod(strings.ToLower(*cliAuth), *cliUsr, *cliPwd); err != nil {
+		flags.Usage()
+		return nil, err
+	}
+
+	// the password is reloaded when it was read from a file and the file changes
+	if srv.password != "" {
+		if passwordFile := opts.SecretFile("password"); passwordFile != "" {
+			srv.passwordFile = passwordFile
+			srv.watchCredentials(passwordFile)
+		}
+	}
+
 	srv.Logger.Info("Hello")
 	srv.Logger.Infof("%ssing TLS.", map[bool]string{true: "U", false: "Not u"}[srv.useTLS])
-	srv.Logger.Infof("Using '%s' as connection url...", srv.url)
+	srv.Logger.Infof("Using '%s' as connection url...", strings.Join(srv.brokerURLs, "', '"))
 	srv.Logger.Infof("Using '%s' as serialization type...", srv.serialization)
 	srv.Logger.Infof("Using '%s' as realm...", srv.realm)
 	if !srv.useAuth {
 		srv.Logger.Info("No authentication configured...")
 	} else {
-		if srv.username != "" && srv.password != "" {
-			srv.Logger.Infof("Using '%s' as user-id...", srv.username)
+		if srv.authMethod != authTLS {
+			srv.Logger.Infof("Using '%s' as user-id with %s authentication...", srv.username, srv.authMethod)
 		} else {
 			srv.Logger.Info("Using TLS client authentication...")
 		}
 	}
-	return srv
+	return srv, nil
 }
 
 // Connect establishes a connection with the broker and must be called before `Run`!
+// When reconnecting is enabled, failed connection attempts are retried with an exponential
+// backoff until the configured number of attempts is exhausted.
 //
 // This function may exit the program early when
 //
 // 1. Logger creation failed.
 //
 // 2. The client failed to join the realm.
+//
+// Use `ConnectE` if you don't want the program to exit.
 func (srv *Service) Connect() {
-	var err error
+	exitOnError(srv.Logger, srv.ConnectE())
+}
 
-	srv.Logger.Debug("Trying to connect to broker")
-	var tlsCfg *tls.Config
-	if srv.useTLS {
-		tlsCfg = &tls.Config{
-			InsecureSkipVerify: false,
-		}
+// ConnectE establishes a connection with the broker just like `Connect`, but returns an
+// `*ExitError` instead of exiting the program. Unless disabled, the introspection procedures
+// `<prefix>.<name>.describe`, `.version` and `.health` are registered and the presence of
+// the service is announced after connecting.
+func (srv *Service) ConnectE() error {
+	return srv.ConnectContext(context.Background())
+}
 
-		if srv.serverCert == nil {
-			tlsCfg.InsecureSkipVerify = true
-		} else {
-			tlsCfg.RootCAs = srv.serverCert
+// ConnectContext establishes a connection with the broker just like `ConnectE`, but stops
+// trying when the given context is canceled, also while dialing.
+func (srv *Service) ConnectContext(ctx context.Context) error {
+	cli, err := srv.connectWithRetry(ctx)
+	if err == errInterrupted {
+		return newExitError(ExitConnect, "Connecting to broker canceled: %s", ctx.Err())
+	} else if err != nil {
+		return err
+	}
+	srv.Logger.Infof("Connected to broker at '%s'", srv.Endpoint())
+
+	if srv.introspectionEnabled {
+		if err := srv.registerIntrospection(); err != nil {
+			return newExitError(ExitRegistration, "Failed to register introspection procedures: %s", err)
+		}
+	}
+	if srv.presenceEnabled {
+		if err := srv.subscribeProbe(); err != nil {
+			return newExitError(ExitRegistration, "Failed to subscribe to presence probes: %s", err)
 		}
+		srv.join(cli)
+	}
+	return nil
+}
 
-		if srv.clientCert != nil {
-			tlsCfg.Certificates = append(tlsCfg.Certificates, *srv.clientCert)
+// CurrentClient returns the client of the current broker connection. Unlike reading the
+// `Client` field, it is safe to call while the service reconnects in `Run`.
+func (srv *Service) CurrentClient() *client.Client {
+	srv.clientLock.RLock()
+	defer srv.clientLock.RUnlock()
+	return srv.Client
+}
+
+// dial performs a single connection attempt to the broker at the given url, which is
+// aborted when the context is canceled.
+func (srv *Service) dial(ctx context.Context, endpoint string) (*client.Client, error) {
+	srv.reloadCredentials()
+	srv.Logger.Debug("Trying to connect to broker")
+	if srv.router != nil {
+		return client.ConnectLocal(srv.router, client.Config{
+			Realm:           srv.realm,
+			Serialization:   srv.serialization,
+			ResponseTimeout: 5 * time.Second,
+		})
+	}
+
+	var tlsCfg *tls.Config
+	if isTLSURL(endpoint) {
+		tlsCfg = srv.tlsConfig()
+		// the rawsocket transport does not derive the server name from the url
+		if tlsCfg.ServerName == "" {
+			tlsCfg.ServerName = endpointHost(endpoint)
 		}
 	}
 
@@ -426,75 +868,186 @@ func (srv *Service) Connect() {
 	}
 
 	if srv.timeout > time.Duration(0) {
-		cfg.Dial = func(network, address string) (net.Conn, error) {
-			return net.DialTimeout(network, address, srv.timeout)
-		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.timeout)
+		defer cancel()
 	}
 
 	if srv.useAuth {
-		helloDetails := wamp.Dict{
-			"authid": srv.username,
-		}
-		cfg.HelloDetails = helloDetails
-
-		authMethods := make(map[string]client.AuthFunc)
-		if srv.useTLS && srv.clientCert != nil {
-			authMethods["tls"] = func(_ *wamp.Challenge) (string, wamp.Dict) {
-				return "", wamp.Dict{}
-			}
-		} else {
-			authMethods["ticket"] = func(_ *wamp.Challenge) (string, wamp.Dict) {
-				return srv.password, wamp.Dict{}
-			}
-		}
-		cfg.AuthHandlers = authMethods
+		cfg.HelloDetails = srv.helloDetails()
+		cfg.AuthHandlers = srv.authHandlers()
 	}
 
-	srv.Client, err = client.ConnectNet(srv.url, cfg)
-	if err != nil {
-		srv.Logger.Criticalf("Failed to connect service to broker: %s", err)
-		os.Exit(ExitConnect)
-	}
-	srv.Logger.Info("Connected to broker")
+	return client.ConnectNetContext(ctx, endpoint, cfg)
 }
 
 // Run starts the microservice. This function blocks until the user interrupts the process
-// with a SIGINT. It can be considered as the main loop of the service. This function may
-// be only called once.
-//
-// This function can exit the program early when
+// with a SIGINT or SIGTERM. It can be considered as the main loop of the service. This
+// function may be only called once.
 //
-// 1. The client failed to leave the realm.
+// When the connection to the broker is lost and reconnecting is enabled, the service
+// reconnects and restores all procedures and subscriptions that were created with
+// `RegisterAll` and `SubscribeAll`.
 //
-// 2. The client connection failed to close.
+// Errors are logged, use `RunE` if you want to handle them yourself.
 func (srv *Service) Run() {
-	defer FunctionTimeout(srv.Client.Close, 1*time.Second)
+	if err := srv.RunE(); err != nil {
+		srv.Logger.Critical(err.Error())
+	}
+}
 
-	sigintChannel := make(chan os.Signal, 1)
-	signal.Notify(sigintChannel, os.Interrupt)
+// RunE starts the microservice just like `Run`. It returns nil when the service was
+// interrupted by the user and an `*ExitError` when the connection to the broker was lost
+// and could not be reestablished.
+func (srv *Service) RunE() error {
+	return srv.RunContext(context.Background())
+}
 
-	pingClose := make(chan struct{})
-	clientClose := make(chan struct{})
-	if srv.pingEnabled {
-		go srv.runPing(pingClose, clientClose)
-	}
+// RunContext starts the microservice just like `RunE`, but additionally shuts down when
+// the given context is canceled.
+//
+// On shutdown all procedures registered with `RegisterAll` are unregistered first, so the
+// broker stops routing new calls to this service. Afterwards the service waits for running
+// invocations to finish, at most for the configured drain timeout, and leaves the realm.
+func (srv *Service) RunContext(ctx context.Context) (err error) {
+	defer func() {
+		FunctionTimeout(srv.CurrentClient().Close, 1*time.Second)
+		if srv.ownsRouter {
+			srv.router.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalChannel)
+	go func() {
+		select {
+		case sig := <-signalChannel:
+			if sig == os.Interrupt {
+				// linebreak after echoed ^C
+				fmt.Println()
+			}
+			srv.Logger.Infof("Received %s, exiting", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	go srv.runCredentialsReload(ctx.Done())
 
 	srv.Logger.Info("Entering main loop")
-	fmt.Println("Send SIGINT to quit")
-	select {
-	case <-sigintChannel:
-		// linebreak after echoed ^C
-		fmt.Println()
-		srv.Logger.Info("Received SIGINT, exiting")
+	fmt.Println("Send SIGINT or SIGTERM to quit")
+	for {
+		cli := srv.CurrentClient()
+		pingClose := make(chan struct{})
+		clientClose := make(chan struct{})
+		if srv.pingEnabled {
+			go srv.runPing(cli, pingClose, clientClose)
+		}
+		if srv.presenceEnabled {
+			go srv.runHeartbeat(cli, pingClose)
+		}
+
+		stopped := false
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case <-cli.Done():
+			srv.Logger.Warning("Connection lost")
+		case <-clientClose:
+			srv.Logger.Warning("Ping failed")
+		}
+		close(pingClose)
+
+		if !stopped && srv.reconnectEnabled {
+			srv.Logger.Info("Reconnecting to broker")
+			FunctionTimeout(cli.Close, 1*time.Second)
+			cli, connectErr := srv.connectWithRetry(ctx)
+			if connectErr == nil {
+				srv.Logger.Infof("Reconnected to broker at '%s'", srv.Endpoint())
+				if srv.presenceEnabled {
+					srv.join(cli)
+				}
+				continue
+			}
+			if connectErr != errInterrupted {
+				err = connectErr
+				break
+			}
+			stopped = true
+		}
 
-	case <-srv.Client.Done():
-		srv.Logger.Info("Connection lost, exiting")
-	case <-clientClose:
-		srv.Logger.Info("Ping failed, exiting")
+		if stopped {
+			if srv.presenceEnabled {
+				srv.leave(cli)
+			}
+			srv.drain()
+		} else {
+			srv.Logger.Info("Connection lost, exiting")
+			err = newExitError(ExitConnect, "Connection to broker lost")
+		}
+		break
 	}
-	close(pingClose)
 	srv.Logger.Info("Leaving main loop")
 	srv.Logger.Info("Bye")
+	return err
+}
+
+// drain unregisters all procedures and waits for running invocations to finish.
+// Invocations arriving afterwards are rejected with `ErrorNotAvailable`.
+func (srv *Service) drain() {
+	srv.registryLock.Lock()
+	for name := range srv.procedures {
+		if err := srv.CurrentClient().Unregister(name); err != nil {
+			srv.Logger.Warningf("Failed to unregister procedure '%s': %s", name, err)
+		}
+	}
+	srv.registryLock.Unlock()
+
+	srv.inflightLock.Lock()
+	srv.draining = true
+	srv.drained = make(chan struct{})
+	if srv.inflight == 0 {
+		close(srv.drained)
+	}
+	drained := srv.drained
+	srv.inflightLock.Unlock()
+
+	srv.Logger.Infof("Waiting up to %s for running invocations to finish", srv.drainTimeout)
+	timer := time.NewTimer(srv.drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-drained:
+	case <-timer.C:
+		srv.Logger.Warning("Drain timeout exceeded, canceling running invocations")
+	}
+}
+
+// track wraps an invocation handler so that running invocations are awaited on shutdown.
+func (srv *Service) track(handler client.InvocationHandler) client.InvocationHandler {
+	return func(ctx context.Context, args wamp.List, kwargs, details wamp.Dict) *client.InvokeResult {
+		srv.inflightLock.Lock()
+		if srv.draining {
+			srv.inflightLock.Unlock()
+			srv.Logger.Warning("Rejecting invocation, the service is shutting down")
+			return ReturnErr(NewError(ErrorNotAvailable))
+		}
+		srv.inflight++
+		srv.inflightLock.Unlock()
+
+		defer func() {
+			srv.inflightLock.Lock()
+			defer srv.inflightLock.Unlock()
+			srv.inflight--
+			if srv.draining && srv.inflight == 0 {
+				close(srv.drained)
+			}
+		}()
+		return handler(ctx, args, kwargs, details)
+	}
 }
 
 // RegistrationError describes an error that occurred during the registration of a remote procedure call.
@@ -504,6 +1057,15 @@ type RegistrationError struct {
 	Inner         error
 }
 
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("Failed to register procedure '%s': %s", e.ProcedureName, e.Inner)
+}
+
+// Unwrap returns the inner error.
+func (e *RegistrationError) Unwrap() error {
+	return e.Inner
+}
+
 // SubscriptionError describes an error that occurred during the subscription on a topic.
 // The struct holds the inner error and the topic name that failed to subscribe.
 type SubscriptionError struct {
@@ -511,6 +1073,15 @@ type SubscriptionError struct {
 	Inner error
 }
 
+func (e *SubscriptionError) Error() string {
+	return fmt.Sprintf("Failed to subscribe to topic '%s': %s", e.Topic, e.Inner)
+}
+
+// Unwrap returns the inner error.
+func (e *SubscriptionError) Unwrap() error {
+	return e.Inner
+}
+
 // HandlerRegistration holds a tuple of a `client.InvocationHandler` and an options map
 // that can be used in the `RegisterAll` function to register multiple method handlers
 // at once.
@@ -528,35 +1099,32 @@ type EventSubscription struct {
 }
 
 // RegisterAll can be used to register multiple remote procedure calls at once.
+// The procedures are registered in the order of their names, registering stops at the
+// first failure. Use `RegisterAllWith` to roll back or to collect all failures.
+// Successfully registered procedures are registered again after a reconnect.
+// The handlers are wrapped with the interceptors added with `Use`.
 func (srv *Service) RegisterAll(procedures map[string]HandlerRegistration) *RegistrationError {
-	for name, regr := range procedures {
-		if err := srv.Client.Register(name, regr.Handler, regr.Options); err != nil {
-			return &RegistrationError{
-				ProcedureName: name,
-				Inner:         err,
-			}
-		}
+	if errs := srv.registerAll(procedures, RegisterOptions{}); len(errs) > 0 {
+		return errs[0]
 	}
-
 	return nil
 }
 
 // SubscribeAll can be used to subscribe to multiple topics at once.
+// The topics are subscribed in the order of their names, subscribing stops at the first
+// failure. Use `SubscribeAllWith` to roll back or to collect all failures.
+// Successfully subscribed topics are subscribed again after a reconnect.
+// The handlers are wrapped with the interceptors added with `Use`.
 func (srv *Service) SubscribeAll(events map[string]EventSubscription) *SubscriptionError {
-	for topic, regr := range events {
-		if err := srv.Client.Subscribe(topic, regr.Handler, regr.Options); err != nil {
-			return &SubscriptionError{
-				Topic: topic,
-				Inner: err,
-			}
-		}
+	if errs := srv.subscribeAll(events, RegisterOptions{}); len(errs) > 0 {
+		return errs[0]
 	}
-
 	return nil
 }
 
-func (srv *Service) runPing(closePing, closeClient chan struct{}) {
+func (srv *Service) runPing(cli *client.Client, closePing, closeClient chan struct{}) {
 	ticker := time.NewTicker(srv.pingInterval)
+	defer ticker.Stop()
 	defer close(closeClient)
 outer:
 	for {
@@ -565,10 +1133,10 @@ outer:
 			break outer
 		case <-ticker.C:
 			if err := FunctionTimeout(func() error {
-				_, err := srv.Client.Call(context.Background(), srv.pingEndpoint, nil, nil, nil, "")
+				_, err := cli.Call(context.Background(), srv.pingEndpoint, nil, nil, nil, "")
 				return err
 			}, srv.pingInterval); err != nil {
-				srv.Logger.Criticalf("Ping failed, exiting: %v", err)
+				srv.Logger.Criticalf("Ping failed: %v", err)
 				break outer
 			}
 		}
@@ -660,9 +1228,12 @@ const (
 
 // Error is the holder of an inner error and a translated `ErrorKind`.
 // Instances may be created with `NewError` or `NewErrorFrom`.
+// Details may hold structured information about the error, they are sent to the caller
+// as keyword arguments by `ReturnErr`.
 type Error struct {
-	kind  ErrorKind
-	inner error
+	kind    ErrorKind
+	inner   error
+	Details wamp.Dict
 }
 
 // NewError creates a new error from a given error kind.
@@ -682,10 +1253,11 @@ func NewErrorFrom(kind ErrorKind, inner error) *Error {
 	}
 }
 
-func (e *Error) Error() string {
+// message returns a human readable description of the error kind.
+func (k ErrorKind) message() string {
 	var msg string
 
-	switch e.kind {
+	switch k {
 	case ErrorBadArgument:
 		msg = "A given argument does not meet its requirements."
 	case ErrorNotAvailable:
@@ -715,13 +1287,34 @@ func (e *Error) Error() string {
 	default:
 		msg = "Unknown error occurred."
 	}
+	return msg
+}
 
+func (e *Error) Error() string {
+	msg := e.kind.message()
 	if e.inner != nil {
 		return fmt.Sprintf("%s\nInner Error: %s", msg, e.inner.Error())
 	}
 	return msg
 }
 
+// Kind returns the kind of the error.
+func (e *Error) Kind() ErrorKind {
+	return e.kind
+}
+
+// Unwrap returns the inner error.
+func (e *Error) Unwrap() error {
+	return e.inner
+}
+
+// Is reports whether the target is an `*Error` of the same kind, so `errors.Is` can be
+// used to check for an error kind, e.g. `errors.Is(err, NewError(ErrorNotFound))`.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.kind == e.kind
+}
+
 // CallerID represents a caller of a wamp RPC invocation
 type CallerID struct {
 	Session  wamp.ID  `call:"caller" publish:"publisher"`
@@ -3,12 +3,18 @@ package service_test
 import (
 	"context"
 	"errors"
+	"net"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
 	"github.com/gammazero/nexus/client"
 	"github.com/gammazero/nexus/wamp"
+	flag "github.com/ogier/pflag"
 )
 
 func TestIsRPCError(t *testing.T) {
@@ -95,6 +101,184 @@ func TestCallerIDParse(t *testing.T) {
 	}
 }
 
+// exitCode returns the code of an `*ExitError` or -1 for other errors.
+func exitCode(err error) int {
+	var exitErr *service.ExitError
+	if !errors.As(err, &exitErr) {
+		return -1
+	}
+	return exitErr.Code
+}
+
+func TestNewEExitCodes(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"--version"}, service.ExitSuccess},
+		{[]string{"--help"}, service.ExitSuccess},
+		{[]string{"--no-such-flag"}, service.ExitArgument},
+		{[]string{"--realm=realm1"}, service.ExitArgument},
+		{[]string{"--broker-url=ws://localhost:8080/ws"}, service.ExitArgument},
+		{[]string{"--broker-url=ftp://localhost/ws", "--realm=realm1"}, service.ExitArgument},
+		{[]string{"--broker-url=ws://localhost:8080/ws", "--realm=realm1", "--ping-interval=0s"}, service.ExitArgument},
+	}
+	for _, test := range tests {
+		srv, err := service.NewE(service.Config{Name: "newe", Args: test.args})
+		if srv != nil || exitCode(err) != test.code {
+			t.Errorf("Expected %v to fail with code %d, got: %v", test.args, test.code, err)
+		}
+	}
+}
+
+// globalFlag is defined on the global flag set like services did before `NewE` used its
+// own flag set.
+var globalFlag = flag.String("global-flag", "", "a flag of the service")
+
+func TestNewEGlobalFlags(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"service", "--global-flag=value", "--version"}
+
+	if _, err := service.NewE(service.Config{Name: "newe"}); exitCode(err) != service.ExitSuccess {
+		t.Fatalf("Expected global flags to be accepted, got: %v", err)
+	}
+	if *globalFlag != "value" {
+		t.Errorf("Expected the global flag to be parsed, got: %q", *globalFlag)
+	}
+}
+
+func TestConnectContextCanceled(t *testing.T) {
+	// the broker accepts connections, but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	srv, err := service.NewE(service.Config{Name: "newe", Args: []string{
+		"--broker-url=ws://" + listener.Addr().String() + "/ws", "--realm=realm1", "--connect-timeout=1m",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create service: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := srv.ConnectContext(ctx); exitCode(err) != service.ExitConnect {
+		t.Errorf("Expected connecting to be canceled with code %d, got: %v", service.ExitConnect, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected connecting to stop when the context is canceled, took: %s", elapsed)
+	}
+}
+
+func TestNewEConnectRun(t *testing.T) {
+	srv, err := service.NewE(service.Config{Name: "newe", Args: []string{
+		"--broker-url=ws://127.0.0.1:1/ws", "--realm=realm1", "--reconnect-enable=false",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create service: %s", err)
+	}
+	if err := srv.ConnectE(); exitCode(err) != service.ExitConnect {
+		t.Errorf("Expected connecting to fail with code %d, got: %v", service.ExitConnect, err)
+	}
+
+	srv, err = service.NewE(service.Config{Name: "newe", Args: []string{"--embedded-router", "--realm=realm1"}})
+	if err != nil {
+		t.Fatalf("Failed to create embedded service: %s", err)
+	}
+	if err := srv.ConnectE(); err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := srv.RunContext(ctx); err != nil {
+		t.Errorf("Expected a clean shutdown, got: %s", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "drain"})
+
+	var lock sync.Mutex
+	steps := []string{}
+	step := func(name string) {
+		lock.Lock()
+		defer lock.Unlock()
+		steps = append(steps, name)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := srv.RegisterAll(map[string]service.HandlerRegistration{
+		"drain.slow": {Handler: func(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+			close(started)
+			<-release
+			step("finished")
+			return service.ReturnEmpty()
+		}},
+		"drain.probe": {Handler: func(_ context.Context, _ wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+			return service.ReturnEmpty()
+		}},
+	}); err != nil {
+		t.Fatalf("Failed to register procedures: %v", err.Inner)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.RunContext(ctx) }()
+	result := make(chan error)
+	go func() {
+		_, err := h.CallE("drain.slow", nil, nil)
+		result <- err
+	}()
+	<-started
+	cancel()
+
+	eventually(t, func() bool {
+		_, err := h.CallE("drain.probe", nil, nil)
+		rpcErr, ok := err.(client.RPCError)
+		return ok && rpcErr.Err.Error == wamp.ErrNoSuchProcedure
+	}, "Expected the procedures to be unregistered on shutdown")
+	step("unregistered")
+	select {
+	case <-srv.CurrentClient().Done():
+		t.Error("Expected the client to stay connected while invocations are running")
+	default:
+	}
+	close(release)
+
+	if err := <-result; err != nil {
+		t.Errorf("Expected the running invocation to finish, got: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got: %s", err)
+	}
+	select {
+	case <-srv.CurrentClient().Done():
+		step("closed")
+	default:
+		t.Error("Expected the client to be closed after draining")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if strings.Join(steps, ",") != "unregistered,finished,closed" {
+		t.Errorf("Unexpected shutdown order: %v", steps)
+	}
+}
+
 func ExampleNew() {
 	srv := service.New(service.Config{
 		Name:          "example",
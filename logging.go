@@ -0,0 +1,120 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/op/go-logging"
+)
+
+// Fields holds structured values of a log message. Pass them as last argument to the
+// logging functions without format string, e.g.
+//
+//	srv.Logger.Info("Procedure called", service.Fields{"procedure": uri})
+//
+// The json log format emits them as separate keys, the other formats append them to the
+// message as `key=value` pairs.
+type Fields map[string]interface{}
+
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, f[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// jsonBackend writes one JSON object per log record. The service name, version and
+// instance ID are looked up by the module of the record, since all services of a process
+// share the logging backend.
+type jsonBackend struct {
+	lock     sync.Mutex
+	out      io.Writer
+	services map[string]Fields
+}
+
+// jsonLog is the backend of the json log format.
+var jsonLog = &jsonBackend{
+	out:      os.Stderr,
+	services: make(map[string]Fields),
+}
+
+// register adds the information of the given service to its log records.
+func (b *jsonBackend) register(srv *Service) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.services[loggerName(srv.name)] = Fields{
+		"service":     srv.name,
+		"version":     srv.version,
+		"instance_id": srv.instanceID,
+	}
+}
+
+// Log implements `logging.Backend`.
+func (b *jsonBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	entry := Fields{}
+	message := rec.Message()
+	args := []interface{}{}
+	for _, arg := range rec.Args {
+		if fields, ok := arg.(Fields); ok {
+			for key, value := range fields {
+				entry[key] = value
+			}
+		} else {
+			args = append(args, arg)
+		}
+	}
+	if len(args) < len(rec.Args) {
+		// fields are only supported without format string, so the message is built
+		// the same way as by go-logging
+		message = strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for key, value := range b.services[rec.Module] {
+		entry[key] = value
+	}
+	entry["level"] = strings.ToLower(level.String())
+	entry["timestamp"] = rec.Time.Format(time.RFC3339Nano)
+	entry["module"] = rec.Module
+	entry["message"] = message
+	if _, file, line, ok := runtime.Caller(calldepth + 1); ok {
+		entry["caller"] = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		// fall back to the string representation of values which can't be encoded
+		for key, value := range entry {
+			entry[key] = fmt.Sprint(value)
+		}
+		if line, err = json.Marshal(entry); err != nil {
+			return err
+		}
+	}
+	_, err = b.out.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	logging "github.com/op/go-logging"
+)
+
+func TestFieldsString(t *testing.T) {
+	fields := Fields{"b": 2, "a": "x"}
+	if fields.String() != "a=x b=2" {
+		t.Errorf("Unexpected fields string: %s", fields)
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	out := &bytes.Buffer{}
+	backend := &jsonBackend{out: out, services: make(map[string]Fields)}
+	srv := newService(Config{Name: "jsonlog", Version: "1.2.3"})
+	backend.register(srv)
+
+	logger := logging.MustGetLogger(loggerName(srv.name))
+	logger.SetBackend(logging.AddModuleLevel(backend))
+	logger.Info("Procedure called", Fields{"procedure": "example.greet", "level": "ignored"})
+	logger.Warningf("Failed %d times", 3)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %q", out.String())
+	}
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("Failed to parse log line %q: %s", line, err)
+		}
+	}
+
+	entry := entries[0]
+	expected := map[string]interface{}{
+		"level":       "info",
+		"message":     "Procedure called",
+		"service":     "jsonlog",
+		"version":     "1.2.3",
+		"instance_id": srv.InstanceID(),
+		"procedure":   "example.greet",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s to be %v, got: %v", key, value, entry[key])
+		}
+	}
+	if caller, _ := entry["caller"].(string); !strings.HasPrefix(caller, "logging_test.go:") {
+		t.Errorf("Unexpected caller: %v", entry["caller"])
+	}
+	if _, ok := entry["timestamp"].(string); !ok {
+		t.Errorf("Expected a timestamp, got: %v", entry["timestamp"])
+	}
+
+	if entries[1]["level"] != "warning" || entries[1]["message"] != "Failed 3 times" {
+		t.Errorf("Unexpected formatted entry: %v", entries[1])
+	}
+}
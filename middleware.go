@@ -0,0 +1,101 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"context"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// Invocation describes a procedure invocation or an event passed through the interceptors.
+// Caller holds the parsed caller of an invocation or the publisher of an event, it is nil
+// when the details could not be parsed.
+type Invocation struct {
+	URI     string
+	Event   bool
+	Caller  *CallerID
+	Args    wamp.List
+	Kwargs  wamp.Dict
+	Details wamp.Dict
+}
+
+// Handler handles an invocation passed through the interceptors. The result is ignored
+// for events.
+type Handler func(ctx context.Context, inv *Invocation) *client.InvokeResult
+
+// Interceptor wraps a handler, e.g. for logging, authorization or metrics. An interceptor
+// may modify the invocation, return its own result or call the next handler.
+type Interceptor func(next Handler) Handler
+
+// Use adds interceptors which are wrapped around every procedure and event handler
+// registered with `RegisterAll`, `SubscribeAll`, `RegisterFunc` and `SubscribeFunc`.
+// Interceptors are applied in the order they were added, the first one is called first.
+// They apply to handlers which were registered before as well.
+func (srv *Service) Use(interceptors ...Interceptor) {
+	srv.interceptorsLock.Lock()
+	defer srv.interceptorsLock.Unlock()
+	srv.interceptors = append(srv.interceptors, interceptors...)
+}
+
+// chain wraps the given handler with all interceptors.
+func (srv *Service) chain(handler Handler) Handler {
+	srv.interceptorsLock.RLock()
+	defer srv.interceptorsLock.RUnlock()
+	for i := len(srv.interceptors) - 1; i >= 0; i-- {
+		handler = srv.interceptors[i](handler)
+	}
+	return handler
+}
+
+// interceptProcedure passes all invocations of the given procedure handler through the
+// interceptors. Panics are recovered and returned as `ErrInternal`.
+func (srv *Service) interceptProcedure(uri string, handler client.InvocationHandler) client.InvocationHandler {
+	final := func(ctx context.Context, inv *Invocation) *client.InvokeResult {
+		return handler(ctx, inv.Args, inv.Kwargs, inv.Details)
+	}
+	return func(ctx context.Context, args wamp.List, kwargs, details wamp.Dict) (result *client.InvokeResult) {
+		defer srv.recoverHandler(uri, &result)
+
+		// the caller is nil when the details are invalid
+		caller, _ := ParseCallerID(details)
+		return srv.chain(final)(ctx, &Invocation{
+			URI:     uri,
+			Caller:  caller,
+			Args:    args,
+			Kwargs:  kwargs,
+			Details: details,
+		})
+	}
+}
+
+// interceptEvent passes all events of the given event handler through the interceptors.
+// Panics are recovered.
+func (srv *Service) interceptEvent(topic string, handler client.EventHandler) client.EventHandler {
+	final := func(_ context.Context, inv *Invocation) *client.InvokeResult {
+		handler(inv.Args, inv.Kwargs, inv.Details)
+		return nil
+	}
+	return func(args wamp.List, kwargs, details wamp.Dict) {
+		defer srv.recoverHandler(topic, nil)
+
+		// the publisher is nil when the details are invalid
+		publisher, _ := ParsePublisherID(details)
+		srv.chain(final)(context.Background(), &Invocation{
+			URI:     topic,
+			Event:   true,
+			Caller:  publisher,
+			Args:    args,
+			Kwargs:  kwargs,
+			Details: details,
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestUse(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "middleware"})
+
+	var lock sync.Mutex
+	seen := []string{}
+	srv.Use(func(next service.Handler) service.Handler {
+		return func(ctx context.Context, inv *service.Invocation) *client.InvokeResult {
+			if inv.Caller == nil {
+				t.Errorf("Expected caller of '%s' to be parsed", inv.URI)
+			}
+			lock.Lock()
+			seen = append(seen, inv.URI)
+			lock.Unlock()
+			return next(ctx, inv)
+		}
+	})
+
+	if err := srv.RegisterFunc("middleware.echo", func(value string) string { return value }); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+	events := make(chan string, 1)
+	if err := srv.SubscribeFunc("middleware.event", func(value string) { events <- value }); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err.Inner)
+	}
+
+	// interceptors added after the registration apply as well
+	srv.Use(func(next service.Handler) service.Handler {
+		return func(ctx context.Context, inv *service.Invocation) *client.InvokeResult {
+			if !inv.Event && inv.Args[0] == "forbidden" {
+				return service.ReturnError(string(wamp.ErrNotAuthorized))
+			}
+			return next(ctx, inv)
+		}
+	})
+
+	if result := h.Call(t, "middleware.echo", wamp.List{"hello"}, nil); result.Arguments[0] != "hello" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+	h.CallError(t, "middleware.echo", wamp.List{"forbidden"}, nil, string(wamp.ErrNotAuthorized))
+	h.Publish(t, "middleware.event", wamp.List{"published"}, nil)
+	select {
+	case value := <-events:
+		if value != "published" {
+			t.Errorf("Unexpected event: %s", value)
+		}
+	case <-time.After(servicetest.Timeout):
+		t.Fatal("Expected event to be received")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{"middleware.echo", "middleware.echo", "middleware.event"}
+	if len(seen) != len(expected) {
+		t.Fatalf("Expected %v, got: %v", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Errorf("Expected %v, got: %v", expected, seen)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OptionsValidator can be implemented by the `Config.Options` structure to validate the
+// service specific options after all flags, environment variables and the configuration
+// file have been parsed.
+type OptionsValidator interface {
+	Validate() error
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// optionValue implements the flag value interface for a single field of the options struct.
+type optionValue struct {
+	field reflect.Value
+}
+
+func (v *optionValue) String() string {
+	if !v.field.IsValid() {
+		return ""
+	}
+	if v.field.Type() == durationType {
+		return time.Duration(v.field.Int()).String()
+	}
+	if v.field.Kind() == reflect.Slice {
+		parts := make([]string, v.field.Len())
+		for i := range parts {
+			parts[i] = v.field.Index(i).String()
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v.field.Interface())
+}
+
+func (v *optionValue) Set(value string) error {
+	if v.field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.field.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.field.Kind() {
+	case reflect.String:
+		v.field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, v.field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.field.SetFloat(f)
+	case reflect.Slice:
+		parts := []string{}
+		if value != "" {
+			parts = strings.Split(value, ",")
+		}
+		// the element type may be a named string type, so the slice is built element-wise
+		slice := reflect.MakeSlice(v.field.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			slice.Index(i).SetString(part)
+		}
+		v.field.Set(slice)
+	}
+	return nil
+}
+
+// IsBoolFlag allows bool options to be passed as `--name` without a value.
+func (v *optionValue) IsBoolFlag() bool {
+	return v.field.Kind() == reflect.Bool
+}
+
+func isSupportedOption(t reflect.Type) bool {
+	if t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// optionName converts a Go field name like `MaxItems` to a flag name like `max-items`.
+func optionName(field string) string {
+	var name []rune
+	runes := []rune(field)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				name = append(name, '-')
+			}
+			r = unicode.ToLower(r)
+		}
+		name = append(name, r)
+	}
+	return string(name)
+}
+
+// optionEnv converts a flag name like `max-items` to an environment variable name like
+// `SERVICE_MAX_ITEMS`.
+func optionEnv(name string) string {
+	return "SERVICE_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// registerOptions defines a flag for every exported field of the struct pointed to by
+// options, see `Config` for the supported struct tags.
+func registerOptions(opts *settings, options interface{}) error {
+	ptr := reflect.ValueOf(options)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return newExitError(ExitArgument, "Options must be a pointer to a struct, got %T", options)
+	}
+	value := ptr.Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" || field.Tag.Get("flag") == "-" {
+			continue
+		}
+		if !isSupportedOption(field.Type) {
+			return newExitError(ExitArgument, "Option %s has unsupported type %s", field.Name, field.Type)
+		}
+
+		name := field.Tag.Get("flag")
+		if name == "" {
+			name = optionName(field.Name)
+		}
+		env := field.Tag.Get("env")
+		if env == "" {
+			env = optionEnv(name)
+		}
+		if opts.flags.Lookup(name) != nil {
+			return newExitError(ExitArgument, "Option %s redefines the flag '%s'", field.Name, name)
+		}
+
+		secret := field.Tag.Get("secret") == "true"
+		if err := opts.Var(&optionValue{field: value.Field(i)}, name, env, field.Tag.Get("usage"), secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateOptions checks that all required options are set and calls the `Validate`
+// method of the options struct if it implements `OptionsValidator`.
+func validateOptions(options interface{}) error {
+	value := reflect.ValueOf(options).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" || field.Tag.Get("flag") == "-" || field.Tag.Get("required") != "true" {
+			continue
+		}
+		if isZero(value.Field(i)) {
+			name := field.Tag.Get("flag")
+			if name == "" {
+				name = optionName(field.Name)
+			}
+			return newExitError(ExitArgument, "Please provide a value for option '%s'!", name)
+		}
+	}
+
+	if validator, ok := options.(OptionsValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return newExitError(ExitArgument, "Invalid options: %s", err)
+		}
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.Interface() == reflect.Zero(v.Type()).Interface()
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flag "github.com/ogier/pflag"
+)
+
+type testMode string
+
+type testOptions struct {
+	MaxItems int           `usage:"maximum number of items"`
+	Timeout  time.Duration `env:"TEST_TIMEOUT"`
+	Verbose  bool
+	Tags     []string
+	Modes    []testMode
+	APIKey   string `required:"true" secret:"true"`
+	Ignored  string `flag:"-"`
+	internal string
+}
+
+func (o *testOptions) Validate() error {
+	if o.MaxItems < 0 {
+		return errors.New("max items must not be negative")
+	}
+	return nil
+}
+
+func TestOptionName(t *testing.T) {
+	names := map[string]string{
+		"MaxItems": "max-items",
+		"APIKey":   "api-key",
+		"Timeout":  "timeout",
+		"UseTLS":   "use-tls",
+	}
+	for field, expected := range names {
+		if name := optionName(field); name != expected {
+			t.Errorf("Expected option name for %s to be '%s', got: %s", field, expected, name)
+		}
+	}
+	if env := optionEnv("max-items"); env != "SERVICE_MAX_ITEMS" {
+		t.Errorf("Expected env name 'SERVICE_MAX_ITEMS', got: %s", env)
+	}
+}
+
+func TestRegisterOptions(t *testing.T) {
+	os.Setenv("TEST_TIMEOUT", "5s")
+	defer os.Unsetenv("TEST_TIMEOUT")
+
+	options := &testOptions{MaxItems: 10}
+	opts := newSettings(flag.NewFlagSet("test", flag.ContinueOnError))
+	if err := registerOptions(opts, options); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if opts.flags.Lookup("ignored") != nil || opts.flags.Lookup("internal") != nil {
+		t.Error("Expected ignored and unexported fields to be skipped")
+	}
+
+	if err := validateOptions(options); err == nil {
+		t.Error("Expected error for missing required option")
+	}
+
+	err := opts.flags.Parse([]string{"--verbose", "--tags=a,b", "--modes=fast,safe", "--api-key=secret", "--max-items=-1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !options.Verbose || len(options.Tags) != 2 || options.APIKey != "secret" || options.Timeout != 5*time.Second {
+		t.Errorf("Unexpected options: %+v", options)
+	}
+	if len(options.Modes) != 2 || options.Modes[1] != "safe" || opts.flags.Lookup("modes").Value.String() != "fast,safe" {
+		t.Errorf("Unexpected modes: %v", options.Modes)
+	}
+	if err := validateOptions(options); err == nil {
+		t.Error("Expected error from Validate")
+	}
+
+	options.MaxItems = 10
+	if err := validateOptions(options); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	fname := writeConfigFile(t, "config.yaml", "tags:\n  - x\n  - y\n  - z\n")
+	defer os.RemoveAll(filepath.Dir(fname))
+	values, err := loadConfigFile(fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	fromFile := &testOptions{}
+	fileOpts := newSettings(flag.NewFlagSet("test", flag.ContinueOnError))
+	if err := registerOptions(fileOpts, fromFile); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := fileOpts.Apply(values); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(fromFile.Tags) != 3 || fromFile.Tags[2] != "z" {
+		t.Errorf("Unexpected tags from configuration file: %v", fromFile.Tags)
+	}
+
+	if err := registerOptions(opts, *options); err == nil {
+		t.Error("Expected error for non-pointer options")
+	}
+}
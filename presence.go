@@ -0,0 +1,273 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// EnvPresenceEnabled defines the environment variable name for the flag indicating
+// whether the service announces its presence.
+const EnvPresenceEnabled string = "SERVICE_ENABLE_PRESENCE"
+
+// EnvPresenceInterval defines the environment variable name for the duration between two
+// presence heartbeats.
+const EnvPresenceInterval string = "SERVICE_PRESENCE_INTERVAL"
+
+// PresenceTopic is the topic services publish their presence announcements to.
+const PresenceTopic = "ee.service.presence"
+
+// PresenceProbeTopic is the topic to request a heartbeat from all running services.
+const PresenceProbeTopic = "ee.service.presence.probe"
+
+// The events of presence announcements. An update is announced when the procedures of a
+// joined instance changed.
+const (
+	PresenceJoin      = "join"
+	PresenceLeave     = "leave"
+	PresenceHeartbeat = "heartbeat"
+	PresenceUpdate    = "update"
+)
+
+// Announcement is published by a service instance on `PresenceTopic` when it joins or
+// leaves the realm, when its procedures change and periodically as heartbeat. Interval is
+// the duration between two heartbeats in seconds.
+type Announcement struct {
+	Event      string   `json:"event"`
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	InstanceID string   `json:"instance_id"`
+	Host       string   `json:"host"`
+	Procedures []string `json:"procedures"`
+	Interval   float64  `json:"interval"`
+}
+
+// newInstanceID creates a random identifier of a service instance.
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// InstanceID returns the random identifier of the service instance, which is announced
+// on `PresenceTopic`.
+func (srv *Service) InstanceID() string {
+	return srv.instanceID
+}
+
+// announce publishes a presence announcement of the service on the given client. It only
+// uses the snapshot of the procedures and never waits for the registry lock, since probes
+// are answered on the goroutine of the client, which pending registrations wait for.
+func (srv *Service) announce(cli *client.Client, event string) {
+	srv.presenceLock.Lock()
+	procedures := srv.presenceProcedures
+	srv.presenceLock.Unlock()
+	options := wamp.Dict{wamp.OptExcludeMe: false}
+	kwargs := wamp.Dict{
+		"event":       event,
+		"name":        srv.name,
+		"version":     srv.version,
+		"instance_id": srv.instanceID,
+		"host":        srv.host,
+		"procedures":  procedures,
+		"interval":    srv.presenceInterval.Seconds(),
+	}
+	if err := cli.Publish(PresenceTopic, options, nil, kwargs); err != nil {
+		srv.Logger.Warningf("Failed to announce %s: %s", event, err)
+	}
+}
+
+// join announces that the service joined the realm on the given client, changes of its
+// procedures are announced from now on.
+func (srv *Service) join(cli *client.Client) {
+	srv.announce(cli, PresenceJoin)
+	atomic.StoreUint32(&srv.presenceJoined, 1)
+}
+
+// leave announces that the service leaves the realm on the given client.
+func (srv *Service) leave(cli *client.Client) {
+	atomic.StoreUint32(&srv.presenceJoined, 0)
+	srv.announce(cli, PresenceLeave)
+}
+
+// updateAnnouncedProcedures takes a snapshot of the registered procedures for the presence
+// announcements. It must be called with the registry lock held.
+func (srv *Service) updateAnnouncedProcedures() {
+	procedures := make([]string, 0, len(srv.procedures))
+	for name := range srv.procedures {
+		procedures = append(procedures, name)
+	}
+	sort.Strings(procedures)
+
+	srv.presenceLock.Lock()
+	srv.presenceProcedures = procedures
+	srv.presenceLock.Unlock()
+}
+
+// announceUpdate announces the changed procedures of the service, unless it did not join
+// yet or is not connected. It must not be called with the registry lock held.
+func (srv *Service) announceUpdate() {
+	if !srv.presenceEnabled || atomic.LoadUint32(&srv.presenceJoined) == 0 {
+		return
+	}
+	if cli, err := srv.connectedClient(); err == nil {
+		srv.announce(cli, PresenceUpdate)
+	}
+}
+
+// subscribeProbe answers presence probes with a heartbeat.
+func (srv *Service) subscribeProbe() *SubscriptionError {
+	return srv.SubscribeAll(map[string]EventSubscription{
+		PresenceProbeTopic: {Handler: func(_ wamp.List, _, _ wamp.Dict) {
+			srv.announce(srv.CurrentClient(), PresenceHeartbeat)
+		}},
+	})
+}
+
+// runHeartbeat publishes heartbeats on the given client until done is closed.
+func (srv *Service) runHeartbeat(cli *client.Client, done chan struct{}) {
+	ticker := time.NewTicker(srv.presenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			srv.announce(cli, PresenceHeartbeat)
+		}
+	}
+}
+
+// Instance describes a running service instance known to a `Discovery`.
+type Instance struct {
+	Name       string
+	Version    string
+	InstanceID string
+	Host       string
+	Procedures []string
+	LastSeen   time.Time
+	Interval   time.Duration
+}
+
+// Discovery keeps a live view of all service instances announcing their presence in the
+// realm. Instances are removed when they leave or miss three heartbeats.
+type Discovery struct {
+	srv       *Service
+	lock      sync.RWMutex
+	instances map[string]Instance
+}
+
+// NewDiscovery subscribes to the presence announcements using the given service and
+// probes all running instances. Only one discovery can be created per service.
+func NewDiscovery(srv *Service) (*Discovery, error) {
+	d := &Discovery{
+		srv:       srv,
+		instances: make(map[string]Instance),
+	}
+	if err := srv.SubscribeFunc(PresenceTopic, d.handle); err != nil {
+		return nil, err
+	}
+	if err := srv.CurrentClient().Publish(PresenceProbeTopic, wamp.Dict{wamp.OptExcludeMe: false}, nil, nil); err != nil {
+		srv.unsubscribeAll([]string{PresenceTopic})
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Discovery) handle(a Announcement) {
+	if a.InstanceID == "" {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// instances which crashed never leave, they are removed once they expired
+	now := time.Now()
+	for id, instance := range d.instances {
+		if !instance.alive(now) {
+			delete(d.instances, id)
+		}
+	}
+	if a.Event == PresenceLeave {
+		delete(d.instances, a.InstanceID)
+		return
+	}
+	d.instances[a.InstanceID] = Instance{
+		Name:       a.Name,
+		Version:    a.Version,
+		InstanceID: a.InstanceID,
+		Host:       a.Host,
+		Procedures: a.Procedures,
+		LastSeen:   now,
+		Interval:   time.Duration(a.Interval * float64(time.Second)),
+	}
+}
+
+// alive checks whether the instance sent a heartbeat recently.
+func (i Instance) alive(now time.Time) bool {
+	return i.Interval <= 0 || now.Sub(i.LastSeen) < 3*i.Interval
+}
+
+// Instances returns all running service instances ordered by name and instance ID.
+func (d *Discovery) Instances() []Instance {
+	return d.filter(func(Instance) bool { return true })
+}
+
+// Find returns all running instances of the service with the given name.
+func (d *Discovery) Find(name string) []Instance {
+	return d.filter(func(i Instance) bool { return i.Name == name })
+}
+
+// FindProcedure returns all running instances providing the given procedure.
+func (d *Discovery) FindProcedure(uri string) []Instance {
+	return d.filter(func(i Instance) bool {
+		for _, procedure := range i.Procedures {
+			if procedure == uri {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (d *Discovery) filter(match func(Instance) bool) []Instance {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	now := time.Now()
+	result := []Instance{}
+	for _, instance := range d.instances {
+		if instance.alive(now) && match(instance) {
+			result = append(result, instance)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].InstanceID < result[j].InstanceID
+	})
+	return result
+}
+
+// Close stops receiving presence announcements.
+func (d *Discovery) Close() {
+	d.srv.unsubscribeAll([]string{PresenceTopic})
+}
@@ -0,0 +1,144 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// eventually polls the condition until it holds or the timeout expired.
+func eventually(t *testing.T, condition func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(servicetest.Timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	announcements := h.Subscribe(t, service.PresenceTopic)
+
+	alpha := h.Service(t, service.Config{Name: "alpha", Version: "1.0.0"})
+	if event := announcements.Expect(t); event.Kwargs["event"] != service.PresenceJoin || event.Kwargs["instance_id"] != alpha.InstanceID() {
+		t.Errorf("Expected join announcement of alpha, got: %v", event.Kwargs)
+	}
+	if err := alpha.RegisterFunc("alpha.work", func() {}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	beta := h.Service(t, service.Config{Name: "beta"})
+	discovery, err := service.NewDiscovery(beta)
+	if err != nil {
+		t.Fatalf("Failed to create discovery: %s", err)
+	}
+	defer discovery.Close()
+
+	eventually(t, func() bool {
+		return len(discovery.FindProcedure("alpha.work")) == 1 && len(discovery.Find("beta")) == 1
+	}, "Expected running instances to be discovered")
+	if instance := discovery.Find("alpha")[0]; instance.Version != "1.0.0" || instance.InstanceID != alpha.InstanceID() {
+		t.Errorf("Unexpected instance: %+v", instance)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- alpha.RunContext(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to run service: %s", err)
+	}
+	eventually(t, func() bool {
+		return len(discovery.Find("alpha")) == 0
+	}, "Expected instance to leave")
+}
+
+func TestPresenceUpdate(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	observer := h.Service(t, service.Config{Name: "observer"})
+	discovery, err := service.NewDiscovery(observer)
+	if err != nil {
+		t.Fatalf("Failed to create discovery: %s", err)
+	}
+	defer discovery.Close()
+	announcements := h.Subscribe(t, service.PresenceTopic)
+
+	// the announcements of the observer are skipped
+	next := func() wamp.Dict {
+		for {
+			if event := announcements.Expect(t); event.Kwargs["name"] == "worker" {
+				return event.Kwargs
+			}
+		}
+	}
+
+	// procedures registered after joining are announced without waiting for a heartbeat
+	worker := h.Service(t, service.Config{Name: "worker"})
+	if err := worker.RegisterFunc("worker.work", func() {}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+	if event := next(); event["event"] != service.PresenceJoin {
+		t.Errorf("Expected join announcement, got: %v", event)
+	}
+	if event := next(); event["event"] != service.PresenceUpdate {
+		t.Errorf("Expected update announcement, got: %v", event)
+	}
+	eventually(t, func() bool {
+		return len(discovery.FindProcedure("worker.work")) == 1
+	}, "Expected the registered procedure to be discovered")
+}
+
+func TestPresenceProbeWhileRegistering(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	worker := h.Service(t, service.Config{Name: "worker"})
+
+	// probes are answered on the client goroutine, which must not wait for the
+	// registrations in progress
+	registered := make(chan struct{})
+	go func() {
+		defer close(registered)
+		for i := 0; i < 50; i++ {
+			if err := worker.RegisterFunc(fmt.Sprintf("worker.work%d", i), func() {}); err != nil {
+				t.Errorf("Failed to register procedure: %v", err.Inner)
+				return
+			}
+		}
+	}()
+
+	deadline := time.After(servicetest.Timeout)
+	for probing := true; probing; {
+		select {
+		case <-registered:
+			probing = false
+		case <-deadline:
+			<-registered
+			t.Fatal("Expected registering to finish while probes are answered")
+		default:
+			h.Publish(t, service.PresenceProbeTopic, nil, nil)
+		}
+	}
+
+	// events are handled in order, so all probes were answered once the sync event
+	// arrived and the client of the worker can be closed
+	synced := make(chan struct{})
+	if err := worker.SubscribeFunc("worker.sync", func() { close(synced) }); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err.Inner)
+	}
+	h.Publish(t, "worker.sync", nil, nil)
+	select {
+	case <-synced:
+	case <-time.After(servicetest.Timeout):
+		t.Fatal("Expected the sync event to be received")
+	}
+}
@@ -0,0 +1,125 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/gammazero/nexus/client"
+)
+
+// reconnectMinInterval is the backoff duration used for the first retry.
+const reconnectMinInterval = 500 * time.Millisecond
+
+var errInterrupted = errors.New("interrupted")
+
+// backoff calculates the duration to wait before the given connection attempt (starting at 0).
+// The duration grows exponentially up to maxInterval, the returned value is jittered randomly
+// between half and the full backoff duration to avoid a whole fleet of services reconnecting
+// at the same time.
+func backoff(attempt int, maxInterval time.Duration) time.Duration {
+	wait := reconnectMinInterval
+	for i := 0; i < attempt && wait < maxInterval; i++ {
+		wait *= 2
+	}
+	if wait > maxInterval {
+		wait = maxInterval
+	}
+	half := wait / 2
+	return half + time.Duration(rand.Int63n(int64(wait-half)+1))
+}
+
+// connectWithRetry connects to the broker and restores all procedures and subscriptions.
+// All broker urls are tried in the order of their health, afterwards the next round is
+// started with backoff when reconnecting is enabled. Dialing and waiting between two rounds
+// are canceled when the context is done, errInterrupted is returned in that case, an
+// `*ExitError` otherwise.
+func (srv *Service) connectWithRetry(ctx context.Context) (*client.Client, error) {
+	attempt := 0
+	for round := 0; ; round++ {
+		err := error(newExitError(ExitConnect, "Failed to connect service to broker: no broker url available"))
+		endpoints := srv.candidates()
+		if len(endpoints) == 0 {
+			// a round without any endpoint, e.g. when all SRV lookups failed, counts as
+			// failed attempt
+			attempt++
+			if srv.reconnectAttempts > 0 && attempt >= srv.reconnectAttempts {
+				return nil, err
+			}
+			srv.Logger.Warningf("Connection attempt %d failed: %s", attempt, err)
+		}
+		for _, endpoint := range endpoints {
+			if ctx.Err() != nil {
+				return nil, errInterrupted
+			}
+			attempt++
+			cli, dialErr := srv.dial(ctx, endpoint)
+			if dialErr != nil && ctx.Err() != nil {
+				return nil, errInterrupted
+			} else if dialErr != nil {
+				srv.endpointFailed(endpoint)
+				err = newExitError(ExitConnect, "Failed to connect service to broker at '%s': %s", endpoint, dialErr)
+			} else if err = srv.restore(cli); err == nil {
+				srv.endpointConnected(endpoint)
+				return cli, nil
+			} else {
+				FunctionTimeout(cli.Close, 1*time.Second)
+			}
+
+			if srv.reconnectAttempts > 0 && attempt >= srv.reconnectAttempts {
+				return nil, err
+			}
+			srv.Logger.Warningf("Connection attempt %d failed: %s", attempt, err)
+		}
+
+		if !srv.reconnectEnabled {
+			return nil, err
+		}
+
+		wait := backoff(round, srv.reconnectMaxInterval)
+		srv.Logger.Warningf("No broker reachable, retrying in %s", wait)
+		select {
+		case <-ctx.Done():
+			return nil, errInterrupted
+		case <-time.After(wait):
+		}
+	}
+}
+
+// restore registers all procedures and subscribes to all topics that were previously
+// set up with `RegisterAll` and `SubscribeAll` on the given client. On success the client
+// becomes the current client of the service, while still holding the registry lock, so no
+// registration can end up on the previous client.
+func (srv *Service) restore(cli *client.Client) error {
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	for name, regr := range srv.procedures {
+		if err := cli.Register(name, srv.track(srv.interceptProcedure(name, regr.Handler)), regr.Options); err != nil {
+			return newExitError(ExitRegistration, "Failed to register procedure '%s' in broker: %s", name, err)
+		}
+	}
+	for topic, regr := range srv.events {
+		if err := cli.Subscribe(topic, srv.interceptEvent(topic, regr.Handler), regr.Options); err != nil {
+			return newExitError(ExitRegistration, "Failed to subscribe to topic '%s' in broker: %s", topic, err)
+		}
+	}
+	if len(srv.procedures) > 0 || len(srv.events) > 0 {
+		srv.Logger.Infof("Restored %d procedures and %d subscriptions", len(srv.procedures), len(srv.events))
+	}
+
+	srv.clientLock.Lock()
+	srv.Client = cli
+	srv.clientLock.Unlock()
+	return nil
+}
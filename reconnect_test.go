@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestBackoff(t *testing.T) {
+	max := 30 * time.Second
+	for attempt := 0; attempt < 20; attempt++ {
+		expected := reconnectMinInterval << uint(attempt)
+		if attempt > 10 || expected > max {
+			expected = max
+		}
+		wait := backoff(attempt, max)
+		if wait < expected/2 || wait > expected {
+			t.Errorf("Expected backoff for attempt %d to be in [%s, %s], got: %s", attempt, expected/2, expected, wait)
+		}
+	}
+}
+
+func TestConnectWithoutEndpoints(t *testing.T) {
+	defer func(orig func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = orig }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+
+	srv := newService(Config{Name: "srvfail"})
+	if err := setupLogger(srv); err != nil {
+		t.Fatalf("Failed to setup logger: %s", err)
+	}
+	srv.brokerURLs = []string{"ws+srv://_wamp._tcp.example.com/ws"}
+	srv.reconnectAttempts = 2
+	srv.reconnectMaxInterval = time.Second
+
+	done := make(chan error)
+	go func() {
+		_, err := srv.connectWithRetry(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConnect {
+			t.Errorf("Expected connect error, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected connecting to give up after the configured attempts")
+	}
+}
+
+func TestReconnectReplacesClient(t *testing.T) {
+	r, err := NewRouter("reconnect")
+	if err != nil {
+		t.Fatalf("Failed to start router: %s", err)
+	}
+	defer r.Close()
+	srv, err := NewEmbedded(Config{Name: "reconnect"}, r, "reconnect")
+	if err != nil {
+		t.Fatalf("Failed to create service: %s", err)
+	}
+	if err := srv.ConnectE(); err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.RunContext(ctx) }()
+
+	echo := func(_ context.Context, args wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+		return &client.InvokeResult{Args: args}
+	}
+	old := srv.CurrentClient()
+	old.Close()
+	registered := make(chan struct{})
+	go func() {
+		defer close(registered)
+		for i := 0; i < 20; i++ {
+			srv.RegisterAll(map[string]HandlerRegistration{
+				fmt.Sprintf("reconnect.echo%d", i): {Handler: echo},
+			})
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.CurrentClient() == old {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the service to reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	<-registered
+
+	caller, err := client.ConnectLocal(r, client.Config{Realm: "reconnect"})
+	if err != nil {
+		t.Fatalf("Failed to connect caller: %s", err)
+	}
+	defer caller.Close()
+	srv.registryLock.Lock()
+	names := []string{}
+	for name := range srv.procedures {
+		names = append(names, name)
+	}
+	srv.registryLock.Unlock()
+	for _, name := range names {
+		if _, err := caller.Call(context.Background(), name, nil, wamp.List{"hi"}, nil, ""); err != nil {
+			t.Errorf("Expected '%s' to be registered on the current client: %s", name, err)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got: %s", err)
+	}
+}
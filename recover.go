@@ -0,0 +1,34 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/gammazero/nexus/client"
+)
+
+// recoverHandler recovers a panic in the handler of the given procedure or topic, it must
+// be deferred. The stack is logged and the result, if given, is set to `ErrInternal`.
+func (srv *Service) recoverHandler(uri string, result **client.InvokeResult) {
+	if r := recover(); r != nil {
+		atomic.AddUint64(&srv.panics, 1)
+		srv.Logger.Criticalf("Recovered panic in handler of '%s': %v\n%s", uri, r, debug.Stack())
+		if result != nil {
+			*result = ReturnError(ErrInternal)
+		}
+	}
+}
+
+// Panics returns the number of panics recovered in procedure and event handlers.
+func (srv *Service) Panics() uint64 {
+	return atomic.LoadUint64(&srv.panics)
+}
@@ -0,0 +1,42 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "recover"})
+
+	if err := srv.RegisterFunc("recover.panic", func() { panic("procedure") }); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+	if err := srv.SubscribeFunc("recover.panic", func() { panic("event") }); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err.Inner)
+	}
+
+	h.CallError(t, "recover.panic", nil, nil, service.ErrInternal)
+	h.Publish(t, "recover.panic", wamp.List{}, nil)
+
+	deadline := time.Now().Add(servicetest.Timeout)
+	for srv.Panics() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected two recovered panics, got: %d", srv.Panics())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the service is still working
+	if err := srv.RegisterFunc("recover.ok", func() string { return "ok" }); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+	if result := h.Call(t, "recover.ok", nil, nil); result.Arguments[0] != "ok" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+}
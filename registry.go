@@ -0,0 +1,261 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gammazero/nexus/client"
+)
+
+var errNotConnected = errors.New("not connected to broker")
+
+// RegisterOptions controls how `RegisterAllWith` and `SubscribeAllWith` handle failures.
+type RegisterOptions struct {
+	// Rollback unregisters all procedures or unsubscribes all topics of the call again
+	// when any of them failed, so either all or none of them are set up.
+	Rollback bool
+
+	// CollectErrors continues after a failure and returns all failures as `MultiError`.
+	CollectErrors bool
+}
+
+// MultiError holds all failures of a `RegisterAllWith` or `SubscribeAllWith` call which
+// collected its errors.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the collected errors. It is only used by `errors.Is` and `errors.As` of
+// Go 1.20 and later, older versions use the `Is` and `As` methods.
+func (e MultiError) Unwrap() []error {
+	return e
+}
+
+// Is reports whether any of the collected errors matches the target.
+func (e MultiError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first collected error that matches the target and sets the target to it.
+func (e MultiError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterAllWith registers multiple remote procedure calls at once just like
+// `RegisterAll`, but handles failures as requested by the options. The returned error is
+// a `*RegistrationError` or, when errors are collected, a `MultiError` of them.
+func (srv *Service) RegisterAllWith(procedures map[string]HandlerRegistration, opts RegisterOptions) error {
+	errs := srv.registerAll(procedures, opts)
+	result := make([]error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+	}
+	return registryError(result, opts)
+}
+
+// SubscribeAllWith subscribes to multiple topics at once just like `SubscribeAll`, but
+// handles failures as requested by the options. The returned error is a
+// `*SubscriptionError` or, when errors are collected, a `MultiError` of them.
+func (srv *Service) SubscribeAllWith(events map[string]EventSubscription, opts RegisterOptions) error {
+	errs := srv.subscribeAll(events, opts)
+	result := make([]error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+	}
+	return registryError(result, opts)
+}
+
+// registryError converts the failures of a registration to the error returned to the user.
+func registryError(errs []error, opts RegisterOptions) error {
+	switch {
+	case len(errs) == 0:
+		return nil
+	case opts.CollectErrors:
+		return MultiError(errs)
+	default:
+		return errs[0]
+	}
+}
+
+// connectedClient returns the current client unless its connection was closed, e.g. while
+// the service reconnects. Calls on a closed client are not allowed.
+func (srv *Service) connectedClient() (*client.Client, error) {
+	cli := srv.CurrentClient()
+	if cli == nil {
+		return nil, errNotConnected
+	}
+	select {
+	case <-cli.Done():
+		return nil, errNotConnected
+	default:
+		return cli, nil
+	}
+}
+
+// registerAll registers the procedures in the order of their names and returns the
+// failures.
+func (srv *Service) registerAll(procedures map[string]HandlerRegistration, opts RegisterOptions) []*RegistrationError {
+	changed := false
+	defer func() {
+		if changed {
+			srv.announceUpdate()
+		}
+	}()
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	names := make([]string, 0, len(procedures))
+	for name := range procedures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cli, connErr := srv.connectedClient()
+	registered := []string{}
+	errs := []*RegistrationError{}
+	for _, name := range names {
+		regr := procedures[name]
+		err := connErr
+		if err == nil {
+			err = cli.Register(name, srv.track(srv.interceptProcedure(name, regr.Handler)), regr.Options)
+		}
+		if err != nil {
+			errs = append(errs, &RegistrationError{
+				ProcedureName: name,
+				Inner:         err,
+			})
+			if !opts.CollectErrors {
+				break
+			}
+			continue
+		}
+		srv.procedures[name] = regr
+		registered = append(registered, name)
+	}
+
+	if len(errs) > 0 && opts.Rollback {
+		for _, name := range registered {
+			if err := cli.Unregister(name); err != nil {
+				srv.Logger.Warningf("Failed to roll back registration of '%s': %s", name, err)
+			}
+			delete(srv.procedures, name)
+		}
+		registered = nil
+	}
+	changed = len(registered) > 0
+	if changed {
+		srv.updateAnnouncedProcedures()
+	}
+	return errs
+}
+
+// subscribeAll subscribes to the topics in the order of their names and returns the
+// failures.
+func (srv *Service) subscribeAll(events map[string]EventSubscription, opts RegisterOptions) []*SubscriptionError {
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	topics := make([]string, 0, len(events))
+	for topic := range events {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	cli, connErr := srv.connectedClient()
+	subscribed := []string{}
+	errs := []*SubscriptionError{}
+	for _, topic := range topics {
+		regr := events[topic]
+		err := connErr
+		if err == nil {
+			err = cli.Subscribe(topic, srv.interceptEvent(topic, regr.Handler), regr.Options)
+		}
+		if err != nil {
+			errs = append(errs, &SubscriptionError{
+				Topic: topic,
+				Inner: err,
+			})
+			if !opts.CollectErrors {
+				break
+			}
+			continue
+		}
+		srv.events[topic] = regr
+		subscribed = append(subscribed, topic)
+	}
+
+	if len(errs) > 0 && opts.Rollback {
+		for _, topic := range subscribed {
+			if err := cli.Unsubscribe(topic); err != nil {
+				srv.Logger.Warningf("Failed to roll back subscription of '%s': %s", topic, err)
+			}
+			delete(srv.events, topic)
+		}
+	}
+	return errs
+}
+
+// unregisterAll unregisters the given procedures, failures are logged.
+func (srv *Service) unregisterAll(names []string) {
+	defer srv.announceUpdate()
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	cli, connErr := srv.connectedClient()
+	for _, name := range names {
+		err := connErr
+		if err == nil {
+			err = cli.Unregister(name)
+		}
+		if err != nil {
+			srv.Logger.Warningf("Failed to unregister '%s': %s", name, err)
+		}
+		delete(srv.procedures, name)
+	}
+	srv.updateAnnouncedProcedures()
+}
+
+// unsubscribeAll unsubscribes from the given topics, failures are logged.
+func (srv *Service) unsubscribeAll(topics []string) {
+	srv.registryLock.Lock()
+	defer srv.registryLock.Unlock()
+
+	cli, connErr := srv.connectedClient()
+	for _, topic := range topics {
+		err := connErr
+		if err == nil {
+			err = cli.Unsubscribe(topic)
+		}
+		if err != nil {
+			srv.Logger.Warningf("Failed to unsubscribe from '%s': %s", topic, err)
+		}
+		delete(srv.events, topic)
+	}
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func echo(_ context.Context, args wamp.List, _, _ wamp.Dict) *client.InvokeResult {
+	return &client.InvokeResult{Args: args}
+}
+
+func TestRegisterAllWith(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	other := h.Service(t, service.Config{Name: "other"})
+	srv := h.Service(t, service.Config{Name: "registry"})
+
+	if err := other.RegisterAll(map[string]service.HandlerRegistration{
+		"registry.b": {Handler: echo},
+	}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	procedures := map[string]service.HandlerRegistration{
+		"registry.a": {Handler: echo},
+		"registry.b": {Handler: echo},
+		"registry.c": {Handler: echo},
+	}
+
+	err := srv.RegisterAllWith(procedures, service.RegisterOptions{Rollback: true})
+	if regErr, ok := err.(*service.RegistrationError); !ok || regErr.ProcedureName != "registry.b" {
+		t.Fatalf("Expected registration of 'registry.b' to fail, got: %v", err)
+	}
+	h.CallError(t, "registry.a", nil, nil, string(wamp.ErrNoSuchProcedure))
+	h.CallError(t, "registry.c", nil, nil, string(wamp.ErrNoSuchProcedure))
+
+	err = srv.RegisterAllWith(procedures, service.RegisterOptions{CollectErrors: true})
+	if multiErr, ok := err.(service.MultiError); !ok || len(multiErr) != 1 {
+		t.Fatalf("Expected a single collected error, got: %v", err)
+	}
+	var regErr *service.RegistrationError
+	if !errors.As(err, &regErr) || regErr.ProcedureName != "registry.b" {
+		t.Errorf("Expected to find the registration error of 'registry.b', got: %v", regErr)
+	}
+	h.Call(t, "registry.a", wamp.List{"a"}, nil)
+	h.Call(t, "registry.c", wamp.List{"c"}, nil)
+}
+
+func TestMultiErrorIs(t *testing.T) {
+	inner := errors.New("inner")
+	err := fmt.Errorf("wrapped: %w", service.MultiError{
+		errors.New("other"),
+		&service.RegistrationError{ProcedureName: "a", Inner: inner},
+	})
+	if !errors.Is(err, inner) {
+		t.Error("Expected the inner error to be found")
+	}
+	if errors.Is(err, errors.New("inner")) {
+		t.Error("Expected a different error not to match")
+	}
+	var subErr *service.SubscriptionError
+	if errors.As(err, &subErr) {
+		t.Error("Expected no subscription error to be found")
+	}
+}
@@ -0,0 +1,82 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EnvFileSuffix is appended to the environment variable name of a secret setting, e.g.
+// `SERVICE_PASSWORD_FILE`, to read the secret from the named file instead. This is the
+// convention used by Docker and Kubernetes secrets.
+const EnvFileSuffix string = "_FILE"
+
+// SecretProvider resolves secret settings, like the password, which were not provided
+// on the command line, the environment or the configuration file. Secrets are requested
+// by their flag name, e.g. `password`.
+type SecretProvider interface {
+	// Secret returns the value of the named secret. ok is false if the provider doesn't
+	// know the secret.
+	Secret(name string) (value string, ok bool, err error)
+}
+
+// FileSecretProvider reads secrets from files in a directory, the file name is the name of
+// the secret, e.g. `/run/secrets/password`.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret implements the `SecretProvider` interface.
+func (p *FileSecretProvider) Secret(name string) (string, bool, error) {
+	fname := filepath.Join(p.Dir, name)
+	if _, err := os.Stat(fname); os.IsNotExist(err) {
+		return "", false, nil
+	}
+	value, err := readSecretFile(name, fname)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// CommandSecretProvider runs a command to obtain secrets, e.g. a vault or password manager
+// client. The name of the secret is appended to the arguments and the secret is read from
+// the standard output of the command. An empty output means the secret is unknown.
+type CommandSecretProvider struct {
+	Command string
+	Args    []string
+}
+
+// Secret implements the `SecretProvider` interface.
+func (p *CommandSecretProvider) Secret(name string) (string, bool, error) {
+	args := append(append([]string{}, p.Args...), name)
+	out, err := exec.Command(p.Command, args...).Output()
+	if err != nil {
+		return "", false, err
+	}
+	value := strings.TrimRight(string(out), "\r\n")
+	return value, value != "", nil
+}
+
+// readSecretFile reads a secret from a file, a trailing line break is removed.
+func readSecretFile(fid, fname string) (string, error) {
+	if err := ensureFileExists(fid, fname); err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", newExitError(ExitArgument, "Failed to read %s: %s", fid, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flag "github.com/ogier/pflag"
+)
+
+func TestSecretFromFileEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(fname, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	os.Setenv("SERVICE_TEST_SECRET_FILE", fname)
+	defer os.Unsetenv("SERVICE_TEST_SECRET_FILE")
+
+	opts := newSettings(flag.NewFlagSet("test", flag.ContinueOnError))
+	secret, err := opts.Secret("secret", "", "SERVICE_TEST_SECRET", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if *secret != "secret" {
+		t.Errorf("Expected secret to be read from file, got: %s", *secret)
+	}
+
+	os.Setenv("SERVICE_TEST_MISSING_FILE", filepath.Join(dir, "missing"))
+	defer os.Unsetenv("SERVICE_TEST_MISSING_FILE")
+	if _, err := opts.Secret("missing", "", "SERVICE_TEST_MISSING", ""); err == nil {
+		t.Error("Expected error for missing secret file")
+	}
+
+	// an existing setting with the name of the _FILE variant is not read as secret file
+	os.Setenv("SERVICE_TEST_KEY_FILE", filepath.Join(dir, "missing"))
+	defer os.Unsetenv("SERVICE_TEST_KEY_FILE")
+	keyFile := opts.String("key-file", "", "SERVICE_TEST_KEY_FILE", "")
+	key, err := opts.Secret("key", "", "SERVICE_TEST_KEY", "")
+	if err != nil || *key != "" || *keyFile != filepath.Join(dir, "missing") {
+		t.Errorf("Expected the key file setting to be independent of the key, got: %q, %q, %v", *key, *keyFile, err)
+	}
+}
+
+func TestSecretProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	files := &FileSecretProvider{Dir: dir}
+	if value, ok, err := files.Secret("password"); !ok || err != nil || value != "secret" {
+		t.Errorf("Expected secret from file, got: %s, %v, %v", value, ok, err)
+	}
+	if _, ok, err := files.Secret("unknown"); ok || err != nil {
+		t.Errorf("Expected unknown secret, got: %v, %v", ok, err)
+	}
+
+	command := &CommandSecretProvider{Command: "echo", Args: []string{"value-of"}}
+	if value, ok, err := command.Secret("password"); !ok || err != nil || value != "value-of password" {
+		t.Errorf("Expected secret from command, got: %s, %v, %v", value, ok, err)
+	}
+
+	opts := newSettings(flag.NewFlagSet("test", flag.ContinueOnError))
+	password, _ := opts.Secret("password", "", "SERVICE_TEST_PASSWORD", "")
+	user := opts.String("user", "", "SERVICE_TEST_USER", "")
+	if err := opts.Resolve(files); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if *password != "secret" || *user != "" {
+		t.Errorf("Expected only secrets to be resolved, got: %s, %s", *password, *user)
+	}
+}
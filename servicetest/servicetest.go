@@ -0,0 +1,214 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+// Package servicetest provides an in-process router to write integration tests for
+// services without a running broker.
+//
+//	func TestEcho(t *testing.T) {
+//		h := servicetest.New(t)
+//		defer h.Close()
+//
+//		srv := h.Service(t, service.Config{Name: "echo"})
+//		srv.RegisterAll(...)
+//
+//		result := h.Call(t, "echo.echo", wamp.List{"hello"}, nil)
+//	}
+package servicetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/router"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// Realm is the realm served by the router of the test harness.
+const Realm = "servicetest"
+
+// Timeout is the default time to wait for calls and events.
+var Timeout = 5 * time.Second
+
+// Harness holds an in-process router and a client used to call procedures and to
+// subscribe to topics of the services under test.
+type Harness struct {
+	Router   router.Router
+	Client   *client.Client
+	services []*service.Service
+}
+
+// Event is a single event received by a `Recorder`.
+type Event struct {
+	Args    wamp.List
+	Kwargs  wamp.Dict
+	Details wamp.Dict
+}
+
+// Recorder records all events published to a topic.
+type Recorder struct {
+	Topic  string
+	events chan Event
+}
+
+// New starts a router and connects the test client, the test fails when this is not
+// possible. Call `Close` when the test is done.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	r, err := service.NewRouter(Realm)
+	if err != nil {
+		t.Fatalf("Failed to start router: %s", err)
+	}
+	cli, err := client.ConnectLocal(r, client.Config{Realm: Realm})
+	if err != nil {
+		r.Close()
+		t.Fatalf("Failed to connect test client: %s", err)
+	}
+	return &Harness{
+		Router: r,
+		Client: cli,
+	}
+}
+
+// Close disconnects all services and the test client and stops the router.
+func (h *Harness) Close() {
+	for _, srv := range h.services {
+		if cli := srv.CurrentClient(); cli != nil {
+			cli.Close()
+		}
+	}
+	h.Client.Close()
+	h.Router.Close()
+}
+
+// Service creates a new service connected to the router of the harness. Neither the
+// command line nor the environment are evaluated.
+func (h *Harness) Service(t testing.TB, cfg service.Config) *service.Service {
+	t.Helper()
+	srv, err := service.NewEmbedded(cfg, h.Router, Realm)
+	if err != nil {
+		t.Fatalf("Failed to create service: %s", err)
+	}
+	if err := srv.ConnectE(); err != nil {
+		t.Fatalf("Failed to connect service: %s", err)
+	}
+	h.services = append(h.services, srv)
+	return srv
+}
+
+// CallE calls the given procedure and returns the result or the error of the call. The
+// identity of the caller is disclosed, so the services can use `service.ParseCallerID`.
+func (h *Harness) CallE(procedure string, args wamp.List, kwargs wamp.Dict) (*wamp.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	return h.Client.Call(ctx, procedure, wamp.Dict{wamp.OptDiscloseMe: true}, args, kwargs, "")
+}
+
+// Call calls the given procedure just like `CallE`, but fails the test when the call
+// returned an error.
+func (h *Harness) Call(t testing.TB, procedure string, args wamp.List, kwargs wamp.Dict) *wamp.Result {
+	t.Helper()
+	result, err := h.CallE(procedure, args, kwargs)
+	if err != nil {
+		t.Fatalf("Call of '%s' failed: %s", procedure, err)
+	}
+	return result
+}
+
+// CallError calls the given procedure and fails the test unless the call returned an
+// error with the given URI.
+func (h *Harness) CallError(t testing.TB, procedure string, args wamp.List, kwargs wamp.Dict, uri string) client.RPCError {
+	t.Helper()
+	_, err := h.CallE(procedure, args, kwargs)
+	rpcErr, ok := err.(client.RPCError)
+	if !ok {
+		t.Fatalf("Expected call of '%s' to fail with '%s', got: %v", procedure, uri, err)
+	}
+	if string(rpcErr.Err.Error) != uri {
+		t.Fatalf("Expected call of '%s' to fail with '%s', got: %s", procedure, uri, rpcErr.Err.Error)
+	}
+	return rpcErr
+}
+
+// Publish publishes an event to the given topic. The identity of the publisher is
+// disclosed, so the services can use `service.ParsePublisherID`.
+func (h *Harness) Publish(t testing.TB, topic string, args wamp.List, kwargs wamp.Dict) {
+	t.Helper()
+	options := wamp.Dict{wamp.OptDiscloseMe: true, wamp.OptAcknowledge: true}
+	if err := h.Client.Publish(topic, options, args, kwargs); err != nil {
+		t.Fatalf("Failed to publish to '%s': %s", topic, err)
+	}
+}
+
+// Subscribe records all events published to the given topic.
+func (h *Harness) Subscribe(t testing.TB, topic string) *Recorder {
+	t.Helper()
+	rec := &Recorder{
+		Topic:  topic,
+		events: make(chan Event, 128),
+	}
+	handler := func(args wamp.List, kwargs, details wamp.Dict) {
+		rec.events <- Event{Args: args, Kwargs: kwargs, Details: details}
+	}
+	if err := h.Client.Subscribe(topic, handler, nil); err != nil {
+		t.Fatalf("Failed to subscribe to '%s': %s", topic, err)
+	}
+	return rec
+}
+
+// Next waits for the next event, ok is false when no event arrived within the timeout.
+func (r *Recorder) Next(timeout time.Duration) (event Event, ok bool) {
+	select {
+	case event = <-r.events:
+		return event, true
+	case <-time.After(timeout):
+		return Event{}, false
+	}
+}
+
+// Expect waits for the next event and fails the test when no event arrived in time.
+func (r *Recorder) Expect(t testing.TB) Event {
+	t.Helper()
+	event, ok := r.Next(Timeout)
+	if !ok {
+		t.Fatalf("Expected an event on '%s'", r.Topic)
+	}
+	return event
+}
+
+// ExpectArgs waits for the next event and fails the test unless it carries the given
+// arguments and keyword arguments.
+func (r *Recorder) ExpectArgs(t testing.TB, args wamp.List, kwargs wamp.Dict) Event {
+	t.Helper()
+	event := r.Expect(t)
+	if !equal(event.Args, args) || !equal(event.Kwargs, kwargs) {
+		t.Fatalf("Expected event on '%s' with %v %v, got: %v %v", r.Topic, args, kwargs, event.Args, event.Kwargs)
+	}
+	return event
+}
+
+// ExpectNone fails the test when an event arrives within the given duration.
+func (r *Recorder) ExpectNone(t testing.TB, wait time.Duration) {
+	t.Helper()
+	if event, ok := r.Next(wait); ok {
+		t.Fatalf("Expected no event on '%s', got: %v %v", r.Topic, event.Args, event.Kwargs)
+	}
+}
+
+// equal compares two lists or dicts, treating nil and empty values alike.
+func equal(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,44 @@
+package servicetest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestHarness(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+
+	srv := h.Service(t, service.Config{Name: "echo"})
+	if err := srv.RegisterAll(map[string]service.HandlerRegistration{
+		"echo.echo": {
+			Handler: func(_ context.Context, args wamp.List, _, details wamp.Dict) *client.InvokeResult {
+				if _, err := service.ParseCallerID(details); err != nil {
+					return service.ReturnError("echo.error.caller")
+				}
+				if err := srv.Client.Publish("echo.echoed", nil, args, nil); err != nil {
+					return service.ReturnError("echo.error.publish")
+				}
+				return service.ReturnValue(args[0])
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to register procedure: %v", err.Inner)
+	}
+
+	events := h.Subscribe(t, "echo.echoed")
+	result := h.Call(t, "echo.echo", wamp.List{"hello"}, nil)
+	if len(result.Arguments) != 1 || result.Arguments[0] != "hello" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+	events.ExpectArgs(t, wamp.List{"hello"}, nil)
+	events.ExpectNone(t, 50*time.Millisecond)
+
+	h.CallError(t, "echo.unknown", nil, nil, string(wamp.ErrNoSuchProcedure))
+}
@@ -0,0 +1,190 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+)
+
+// ServiceSpec describes the whole API of a service: the procedures it provides, the topics
+// it subscribes to and the topics it publishes. Use `Service.Apply` to register all
+// procedures and subscriptions of a spec, `Service.Spec` returns the applied specs for
+// introspection. Name, version and description are taken from the `Config` when empty.
+type ServiceSpec struct {
+	Name          string             `json:"name"`
+	Version       string             `json:"version"`
+	Description   string             `json:"description,omitempty"`
+	Procedures    []ProcedureSpec    `json:"procedures,omitempty"`
+	Subscriptions []SubscriptionSpec `json:"subscriptions,omitempty"`
+	Topics        []TopicSpec        `json:"topics,omitempty"`
+}
+
+// ProcedureSpec describes a procedure of a service. The handler is either a
+// `client.InvocationHandler` or a typed function as accepted by `RegisterFunc`.
+// When roles are given, only callers having any of them may call the procedure, all other
+// callers receive the `ErrorPermissionDenied` error. Args and Result describe the
+// arguments and the result, e.g. using a JSON schema.
+type ProcedureSpec struct {
+	URI         string      `json:"uri"`
+	Description string      `json:"description,omitempty"`
+	Options     wamp.Dict   `json:"options,omitempty"`
+	Roles       []string    `json:"roles,omitempty"`
+	Args        interface{} `json:"args,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+	Handler     interface{} `json:"-"`
+}
+
+// SubscriptionSpec describes a topic a service subscribes to. The handler is either a
+// `client.EventHandler` or a typed function as accepted by `SubscribeFunc`. Schema
+// describes the events, e.g. using a JSON schema.
+type SubscriptionSpec struct {
+	Topic       string      `json:"topic"`
+	Description string      `json:"description,omitempty"`
+	Options     wamp.Dict   `json:"options,omitempty"`
+	Schema      interface{} `json:"schema,omitempty"`
+	Handler     interface{} `json:"-"`
+}
+
+// TopicSpec describes a topic a service publishes events to.
+type TopicSpec struct {
+	Topic       string      `json:"topic"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema,omitempty"`
+}
+
+// procedureHandler creates the invocation handler of a procedure spec, which checks the
+// roles of the caller before calling the handler.
+func (srv *Service) procedureHandler(p ProcedureSpec) (client.InvocationHandler, error) {
+	var handler client.InvocationHandler
+	switch h := p.Handler.(type) {
+	case client.InvocationHandler:
+		handler = h
+	case func(context.Context, wamp.List, wamp.Dict, wamp.Dict) *client.InvokeResult:
+		handler = h
+	default:
+		var err error
+		if handler, err = srv.invocationHandler(p.URI, p.Handler); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Roles) == 0 {
+		return handler, nil
+	}
+
+	return func(ctx context.Context, args wamp.List, kwargs, details wamp.Dict) *client.InvokeResult {
+		caller, err := ParseCallerID(details)
+		if err != nil || !caller.HasAnyRole(p.Roles) {
+			return ReturnErr(NewError(ErrorPermissionDenied))
+		}
+		return handler(ctx, args, kwargs, details)
+	}, nil
+}
+
+// eventSubscription creates the event handler of a subscription spec.
+func (srv *Service) eventSubscription(s SubscriptionSpec) (client.EventHandler, error) {
+	switch h := s.Handler.(type) {
+	case client.EventHandler:
+		return h, nil
+	case func(wamp.List, wamp.Dict, wamp.Dict):
+		return h, nil
+	default:
+		return srv.eventHandler(s.Topic, s.Handler)
+	}
+}
+
+// Apply registers all procedures and subscribes to all topics of the spec. Either all or
+// none of them are set up, the returned error is a `*RegistrationError` or a
+// `*SubscriptionError`. Applied specs are returned by `Spec`.
+func (srv *Service) Apply(spec ServiceSpec) error {
+	procedures := map[string]HandlerRegistration{}
+	for _, p := range spec.Procedures {
+		if p.URI == "" {
+			return &RegistrationError{Inner: errors.New("procedure without uri")}
+		}
+		handler, err := srv.procedureHandler(p)
+		if err != nil {
+			return &RegistrationError{ProcedureName: p.URI, Inner: err}
+		}
+		options := wamp.Dict{}
+		for key, value := range p.Options {
+			options[key] = value
+		}
+		if len(p.Roles) > 0 {
+			// the caller is required to check the roles
+			options[wamp.OptDiscloseCaller] = true
+		}
+		procedures[p.URI] = HandlerRegistration{Handler: handler, Options: options}
+	}
+
+	events := map[string]EventSubscription{}
+	for _, s := range spec.Subscriptions {
+		if s.Topic == "" {
+			return &SubscriptionError{Inner: errors.New("subscription without topic")}
+		}
+		handler, err := srv.eventSubscription(s)
+		if err != nil {
+			return &SubscriptionError{Topic: s.Topic, Inner: err}
+		}
+		events[s.Topic] = EventSubscription{Handler: handler, Options: s.Options}
+	}
+
+	if err := srv.RegisterAllWith(procedures, RegisterOptions{Rollback: true}); err != nil {
+		return err
+	}
+	if err := srv.SubscribeAllWith(events, RegisterOptions{Rollback: true}); err != nil {
+		names := make([]string, 0, len(procedures))
+		for name := range procedures {
+			names = append(names, name)
+		}
+		srv.unregisterAll(names)
+		return err
+	}
+
+	srv.specLock.Lock()
+	defer srv.specLock.Unlock()
+	srv.spec.Procedures = append(srv.spec.Procedures, spec.Procedures...)
+	srv.spec.Subscriptions = append(srv.spec.Subscriptions, spec.Subscriptions...)
+	srv.spec.Topics = append(srv.spec.Topics, spec.Topics...)
+	if spec.Name != "" {
+		srv.spec.Name = spec.Name
+	}
+	if spec.Version != "" {
+		srv.spec.Version = spec.Version
+	}
+	if spec.Description != "" {
+		srv.spec.Description = spec.Description
+	}
+	return nil
+}
+
+// Spec returns the specs applied to the service merged into one.
+func (srv *Service) Spec() ServiceSpec {
+	srv.specLock.Lock()
+	defer srv.specLock.Unlock()
+
+	spec := srv.spec
+	if spec.Name == "" {
+		spec.Name = srv.name
+	}
+	if spec.Version == "" {
+		spec.Version = srv.version
+	}
+	if spec.Description == "" {
+		spec.Description = srv.description
+	}
+	spec.Procedures = append([]ProcedureSpec{}, srv.spec.Procedures...)
+	spec.Subscriptions = append([]SubscriptionSpec{}, srv.spec.Subscriptions...)
+	spec.Topics = append([]TopicSpec{}, srv.spec.Topics...)
+	return spec
+}
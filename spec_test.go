@@ -0,0 +1,91 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/wamp"
+)
+
+func TestApplySpec(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "spec", Version: "1.2.3"})
+
+	// the in-process test client has the role "trusted"
+	events := make(chan string, 1)
+	err := srv.Apply(service.ServiceSpec{
+		Description: "Service under test",
+		Procedures: []service.ProcedureSpec{{
+			URI:     "spec.public",
+			Handler: func(value string) string { return value },
+		}, {
+			URI:     "spec.admin",
+			Roles:   []string{"admin"},
+			Handler: func() string { return "secret" },
+		}, {
+			URI:     "spec.trusted",
+			Roles:   []string{"admin", "trusted"},
+			Handler: func() string { return "welcome" },
+		}},
+		Subscriptions: []service.SubscriptionSpec{{
+			Topic:   "spec.event",
+			Handler: func(value string) { events <- value },
+		}},
+		Topics: []service.TopicSpec{{
+			Topic:       "spec.changed",
+			Description: "Published on every change",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply spec: %s", err)
+	}
+
+	if result := h.Call(t, "spec.public", wamp.List{"hello"}, nil); result.Arguments[0] != "hello" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+	h.CallError(t, "spec.admin", nil, nil, service.ErrorPermissionDenied.URI())
+	if result := h.Call(t, "spec.trusted", nil, nil); result.Arguments[0] != "welcome" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+	h.Publish(t, "spec.event", wamp.List{"published"}, nil)
+	select {
+	case <-events:
+	case <-time.After(servicetest.Timeout):
+		t.Error("Expected event to be received")
+	}
+
+	spec := srv.Spec()
+	if spec.Name != "spec" || spec.Version != "1.2.3" || spec.Description != "Service under test" {
+		t.Errorf("Unexpected spec: %+v", spec)
+	}
+	if len(spec.Procedures) != 3 || len(spec.Subscriptions) != 1 || len(spec.Topics) != 1 {
+		t.Errorf("Unexpected spec: %+v", spec)
+	}
+}
+
+func TestApplySpecRollback(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "spec"})
+
+	err := srv.Apply(service.ServiceSpec{
+		Procedures: []service.ProcedureSpec{{
+			URI:     "spec.valid",
+			Handler: func() {},
+		}},
+		Subscriptions: []service.SubscriptionSpec{{
+			Topic:   "spec.invalid",
+			Handler: func() int { return 0 },
+		}},
+	})
+	if _, ok := err.(*service.SubscriptionError); !ok {
+		t.Fatalf("Expected subscription error, got: %v", err)
+	}
+	h.CallError(t, "spec.valid", nil, nil, string(wamp.ErrNoSuchProcedure))
+	if len(srv.Spec().Procedures) != 0 {
+		t.Error("Expected failed spec not to be recorded")
+	}
+}
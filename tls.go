@@ -0,0 +1,129 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// EnvTLSInsecure defines the environment variable name for the flag disabling the
+// verification of the server certificate.
+const EnvTLSInsecure string = "TLS_INSECURE"
+
+// EnvTLSMinVersion defines the environment variable name for the minimum TLS version
+// to accept, e.g. "1.2".
+const EnvTLSMinVersion string = "TLS_MIN_VERSION"
+
+// EnvTLSServerName defines the environment variable name for the server name to send
+// via SNI and to verify the server certificate against.
+const EnvTLSServerName string = "TLS_SERVER_NAME"
+
+// EnvTLSPins defines the environment variable name for a comma-separated list of base64
+// encoded SHA-256 hashes of the subject public key info of trusted certificates.
+const EnvTLSPins string = "TLS_PIN_SHA256"
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the TLS version constant for the given version string, TLS 1.2
+// is used if the version is empty.
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, newExitError(ExitArgument, "Unknown TLS version '%s', use 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// parseTLSPins decodes a comma-separated list of base64 encoded SHA-256 hashes.
+func parseTLSPins(pins string) ([][]byte, error) {
+	result := [][]byte{}
+	for _, pin := range strings.Split(pins, ",") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, newExitError(ExitArgument, "TLS pin '%s' is not a base64 encoded SHA-256 hash", pin)
+		}
+		result = append(result, hash)
+	}
+	return result, nil
+}
+
+// verifyPins checks that the server certificate matches one of the configured public key
+// pins. When the certificate was verified, any certificate of the verified chains may match,
+// otherwise only the leaf certificate. The other certificates sent by the server are never
+// trusted, as anybody can send the pinned certificate along with their own.
+func verifyPins(pins [][]byte, insecure bool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		candidates := []*x509.Certificate{}
+		if insecure {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			cert, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, cert)
+		} else {
+			for _, chain := range verifiedChains {
+				candidates = append(candidates, chain...)
+			}
+		}
+
+		for _, cert := range candidates {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if string(hash[:]) == string(pin) {
+					return nil
+				}
+			}
+		}
+		return errors.New("server certificate does not match any TLS pin")
+	}
+}
+
+// tlsConfig creates the TLS configuration for a connection to the broker. The server
+// certificate is verified against the configured CA or the system roots, unless the
+// verification was disabled explicitly.
+func (srv *Service) tlsConfig() *tls.Config {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: srv.tlsInsecure,
+		MinVersion:         srv.tlsMinVersion,
+		ServerName:         srv.tlsServerName,
+		RootCAs:            srv.currentServerCert(),
+	}
+
+	if len(srv.tlsPins) > 0 {
+		tlsCfg.VerifyPeerCertificate = verifyPins(srv.tlsPins, srv.tlsInsecure)
+	}
+
+	// the certificate itself may be replaced by the credentials reload at any time, so
+	// only the file name set up at startup is checked here
+	if srv.clientCertFile != "" {
+		tlsCfg.GetClientCertificate = srv.getClientCertificate
+	}
+	return tlsCfg
+}
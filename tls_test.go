@@ -0,0 +1,155 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logging "github.com/op/go-logging"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	if v, err := parseTLSVersion(""); err != nil || v != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 by default, got: %x (%v)", v, err)
+	}
+	if v, err := parseTLSVersion("1.3"); err != nil || v != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got: %x (%v)", v, err)
+	}
+	if _, err := parseTLSVersion("2.0"); err == nil {
+		t.Error("Expected error for unknown TLS version")
+	}
+}
+
+// newTestCert creates a certificate signed by the given parent, it is self-signed when the
+// parent is nil.
+func newTestCert(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(raw)
+	return cert, key
+}
+
+func TestVerifyPins(t *testing.T) {
+	cert, _ := newTestCert(t, "broker", false, nil, nil)
+	raw := cert.Raw
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	other := sha256.Sum256([]byte("other"))
+
+	pins, err := parseTLSPins(base64.StdEncoding.EncodeToString(other[:]) + ", " + base64.StdEncoding.EncodeToString(hash[:]))
+	if err != nil || len(pins) != 2 {
+		t.Fatalf("Expected two pins, got: %v (%v)", pins, err)
+	}
+	if err := verifyPins(pins, true)([][]byte{raw}, nil); err != nil {
+		t.Errorf("Expected certificate to match pin, got: %v", err)
+	}
+	if err := verifyPins(pins[:1], true)([][]byte{raw}, nil); err == nil {
+		t.Error("Expected certificate not to match pin")
+	}
+	if err := verifyPins(pins, false)([][]byte{raw}, [][]*x509.Certificate{{cert}}); err != nil {
+		t.Errorf("Expected verified certificate to match pin, got: %v", err)
+	}
+	if _, err := parseTLSPins("invalid"); err == nil {
+		t.Error("Expected error for invalid pin")
+	}
+}
+
+func TestVerifyPinsIgnoresExtraCertificates(t *testing.T) {
+	broker, _ := newTestCert(t, "broker", false, nil, nil)
+	hash := sha256.Sum256(broker.RawSubjectPublicKeyInfo)
+	pins := [][]byte{hash[:]}
+
+	// the attacker sends their own leaf followed by the public broker certificate
+	ca, caKey := newTestCert(t, "mis-issued ca", true, nil, nil)
+	leaf, _ := newTestCert(t, "broker", false, ca, caKey)
+	rawCerts := [][]byte{leaf.Raw, broker.Raw}
+
+	if err := verifyPins(pins, true)(rawCerts, nil); err == nil {
+		t.Error("Expected pinned certificate behind a different leaf to be rejected without verification")
+	}
+	if err := verifyPins(pins, false)(rawCerts, [][]*x509.Certificate{{leaf, ca}}); err == nil {
+		t.Error("Expected pinned certificate outside of the verified chain to be rejected")
+	}
+}
+
+func TestTLSConfigClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, key := newTestCert(t, "client", false, nil, nil)
+	rawKey, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	srv := &Service{Logger: logging.MustGetLogger("test")}
+	if srv.tlsConfig().GetClientCertificate != nil {
+		t.Error("Expected no client certificate without certificate file")
+	}
+
+	if srv.clientCert, err = loadClientCert(certFile, keyFile); err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	srv.clientCertFile, srv.clientKeyFile = certFile, keyFile
+	srv.watchCredentials(certFile, keyFile)
+
+	// the client certificate is reloaded while TLS configurations are created
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 20; i++ {
+			later := time.Now().Add(time.Duration(i) * time.Minute)
+			os.Chtimes(certFile, later, later)
+			srv.reloadCredentials()
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		tlsCfg := srv.tlsConfig()
+		if tlsCfg.GetClientCertificate == nil {
+			t.Fatal("Expected client certificate to be presented")
+		}
+		if presented, _ := tlsCfg.GetClientCertificate(nil); len(presented.Certificate) == 0 {
+			t.Fatal("Expected the loaded client certificate to be presented")
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/* service - robµlab convenience wrapper for easy microservice creation.
+ *
+ * Copyright (C) 2017-2018  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *     Martin Koppehel <martin.koppehel@st.ovgu.de>,
+ *
+ * This file is part of robµlab.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/gammazero/nexus/client"
+	"github.com/gammazero/nexus/wamp"
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	callerIDType = reflect.TypeOf(&CallerID{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// typedFunc describes a Go function used as typed handler.
+type typedFunc struct {
+	fn        reflect.Value
+	hasCtx    bool
+	hasCaller bool
+	request   reflect.Type
+	hasResult bool
+	hasErr    bool
+}
+
+// newTypedFunc checks the signature of a typed handler, which takes an optional
+// `context.Context`, an optional `*CallerID` and an optional request value in this order
+// and returns an optional result value and an optional error.
+func newTypedFunc(fn interface{}, allowCtx bool) (*typedFunc, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("handler must be a function, got %T", fn)
+	}
+
+	t := v.Type()
+	f := &typedFunc{fn: v}
+	i := 0
+	if allowCtx && i < t.NumIn() && t.In(i) == contextType {
+		f.hasCtx = true
+		i++
+	}
+	if i < t.NumIn() && t.In(i) == callerIDType {
+		f.hasCaller = true
+		i++
+	}
+	if i < t.NumIn() {
+		f.request = t.In(i)
+		i++
+	}
+	if i < t.NumIn() || t.IsVariadic() {
+		return nil, fmt.Errorf("unsupported handler signature %s", t)
+	}
+
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		f.hasErr = t.Out(0) == errorType
+		f.hasResult = !f.hasErr
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, fmt.Errorf("the last return value of handler %s must be an error", t)
+		}
+		f.hasResult = true
+		f.hasErr = true
+	default:
+		return nil, fmt.Errorf("unsupported handler signature %s", t)
+	}
+	return f, nil
+}
+
+// arguments decodes the request and builds the arguments to call the function with. The
+// error is an `*Error` of kind `ErrorBadArgument` when decoding failed.
+func (f *typedFunc) arguments(ctx context.Context, caller *CallerID, args wamp.List, kwargs wamp.Dict) ([]reflect.Value, error) {
+	in := []reflect.Value{}
+	if f.hasCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	if f.hasCaller {
+		in = append(in, reflect.ValueOf(caller))
+	}
+	if f.request != nil {
+		request, err := decodeRequest(f.request, args, kwargs)
+		if err != nil {
+			return nil, NewErrorFrom(ErrorBadArgument, err)
+		}
+		in = append(in, request)
+	}
+	return in, nil
+}
+
+// call calls the function with the given arguments and returns its result and error.
+func (f *typedFunc) call(in []reflect.Value) (interface{}, error) {
+	out := f.fn.Call(in)
+	var result interface{}
+	if f.hasResult {
+		result = out[0].Interface()
+	}
+	if f.hasErr {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// decodeRequest decodes the arguments of an invocation or event into a value of the given
+// type. Structs and maps are decoded from the keyword arguments, if there are any, all
+// other types from a single argument or the list of arguments. Field names are matched
+// using the `json` struct tags.
+func decodeRequest(t reflect.Type, args wamp.List, kwargs wamp.Dict) (reflect.Value, error) {
+	keyed := t.Kind() == reflect.Struct || t.Kind() == reflect.Map ||
+		(t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct)
+
+	var input interface{}
+	switch {
+	case keyed && len(kwargs) > 0:
+		input = kwargs
+	case len(args) == 1:
+		input = args[0]
+	case len(args) > 1:
+		input = args
+	}
+
+	result := reflect.New(t)
+	if input == nil {
+		return result.Elem(), nil
+	}
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           result.Interface(),
+		TagName:          "json",
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := dec.Decode(input); err != nil {
+		return reflect.Value{}, err
+	}
+	return result.Elem(), nil
+}
+
+// invocationHandler wraps a typed function into a `client.InvocationHandler`.
+func (srv *Service) invocationHandler(uri string, fn interface{}) (client.InvocationHandler, error) {
+	f, err := newTypedFunc(fn, true)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, args wamp.List, kwargs, details wamp.Dict) *client.InvokeResult {
+		var caller *CallerID
+		if f.hasCaller {
+			var err error
+			if caller, err = ParseCallerID(details); err != nil {
+				return ReturnErr(NewErrorFrom(ErrorBadArgument, err))
+			}
+		}
+
+		in, err := f.arguments(ctx, caller, args, kwargs)
+		if err != nil {
+			return ReturnErr(err)
+		}
+		result, err := f.call(in)
+		if err != nil {
+			var e *Error
+			if !errors.As(err, &e) {
+				srv.Logger.Errorf("Procedure '%s' failed: %s", uri, err)
+			}
+			return ReturnErr(err)
+		}
+		if !f.hasResult {
+			return ReturnEmpty()
+		}
+		return ReturnValue(result)
+	}, nil
+}
+
+// RegisterFunc registers a Go function as remote procedure. The function may take a
+// `context.Context`, a `*CallerID` and a request value, in this order, each of them is
+// optional, and may return a result value and an error, e.g.
+//
+//	func(ctx context.Context, caller *CallerID, req Request) (Response, error)
+//
+// The request is decoded from the arguments of the invocation using mapstructure, the
+// result is returned using `ReturnValue` and errors are returned using `ReturnErr`.
+func (srv *Service) RegisterFunc(uri string, fn interface{}) *RegistrationError {
+	handler, err := srv.invocationHandler(uri, fn)
+	if err != nil {
+		return &RegistrationError{
+			ProcedureName: uri,
+			Inner:         err,
+		}
+	}
+	return srv.RegisterAll(map[string]HandlerRegistration{
+		uri: {Handler: handler},
+	})
+}
+
+// eventHandler wraps a typed function into a `client.EventHandler`. Events which can't be
+// decoded are logged and counted.
+func (srv *Service) eventHandler(topic string, fn interface{}) (client.EventHandler, error) {
+	f, err := newTypedFunc(fn, false)
+	if err != nil {
+		return nil, err
+	}
+	if f.hasResult {
+		return nil, fmt.Errorf("event handler %s must not return a value", f.fn.Type())
+	}
+	return func(args wamp.List, kwargs, details wamp.Dict) {
+		var caller *CallerID
+		if f.hasCaller {
+			var err error
+			if caller, err = ParsePublisherID(details); err != nil {
+				atomic.AddUint64(&srv.decodeFailures, 1)
+				srv.Logger.Warningf("Failed to parse publisher of event on '%s': %s", topic, err)
+				return
+			}
+		}
+
+		in, err := f.arguments(nil, caller, args, kwargs)
+		if err != nil {
+			atomic.AddUint64(&srv.decodeFailures, 1)
+			srv.Logger.Warningf("Failed to decode event on '%s': %s", topic, err)
+			return
+		}
+		if _, err := f.call(in); err != nil {
+			srv.Logger.Errorf("Handling event on '%s' failed: %s", topic, err)
+		}
+	}, nil
+}
+
+// SubscribeFunc subscribes a Go function to a topic. The function may take a `*CallerID`
+// holding the publisher and an event value, in this order, each of them is optional, and
+// may return an error, e.g.
+//
+//	func(publisher *CallerID, event Event) error
+//
+// The event is decoded from the arguments of the publication using mapstructure. Events
+// which can't be decoded are logged and counted, see `DecodeFailures`, returned errors are
+// logged.
+func (srv *Service) SubscribeFunc(topic string, fn interface{}) *SubscriptionError {
+	handler, err := srv.eventHandler(topic, fn)
+	if err != nil {
+		return &SubscriptionError{
+			Topic: topic,
+			Inner: err,
+		}
+	}
+	return srv.SubscribeAll(map[string]EventSubscription{
+		topic: {Handler: handler},
+	})
+}
+
+// DecodeFailures returns the number of events dropped by typed event handlers because
+// they could not be decoded.
+func (srv *Service) DecodeFailures() uint64 {
+	return atomic.LoadUint64(&srv.decodeFailures)
+}
@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EmbeddedEnterprises/service"
+	"github.com/EmbeddedEnterprises/service/servicetest"
+	"github.com/gammazero/nexus/wamp"
+)
+
+type greetRequest struct {
+	Name  string `json:"name"`
+	Times int    `json:"times"`
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestRegisterFunc(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "typed"})
+
+	if err := srv.RegisterFunc("typed.greet", func(ctx context.Context, caller *service.CallerID, req greetRequest) (greetResponse, error) {
+		if caller == nil || caller.Session == 0 {
+			return greetResponse{}, errors.New("caller not disclosed")
+		}
+		if req.Name == "" {
+			return greetResponse{}, service.NewError(service.ErrorBadArgument)
+		}
+		return greetResponse{Greeting: "Hello " + req.Name}, nil
+	}); err != nil {
+		t.Fatalf("Failed to register typed procedure: %v", err.Inner)
+	}
+	if err := srv.RegisterFunc("typed.sum", func(values []int) int {
+		sum := 0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	}); err != nil {
+		t.Fatalf("Failed to register typed procedure: %v", err.Inner)
+	}
+	if err := srv.RegisterFunc("typed.load", func() error {
+		return fmt.Errorf("load: %w", service.NewError(service.ErrorNotFound))
+	}); err != nil {
+		t.Fatalf("Failed to register typed procedure: %v", err.Inner)
+	}
+	if err := srv.RegisterFunc("typed.fail", func() error {
+		return errors.New("failed")
+	}); err != nil {
+		t.Fatalf("Failed to register typed procedure: %v", err.Inner)
+	}
+
+	result := h.Call(t, "typed.greet", nil, wamp.Dict{"name": "robµlab", "times": "2"})
+	if response, ok := result.Arguments[0].(greetResponse); !ok || response.Greeting != "Hello robµlab" {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+	result = h.Call(t, "typed.sum", wamp.List{1, 2, 3}, nil)
+	if result.Arguments[0] != 6 {
+		t.Errorf("Unexpected result: %v", result.Arguments)
+	}
+
+	h.CallError(t, "typed.greet", nil, wamp.Dict{"name": ""}, "ee.error.bad_argument")
+	h.CallError(t, "typed.greet", nil, wamp.Dict{"times": "many"}, "ee.error.bad_argument")
+	h.CallError(t, "typed.load", nil, nil, "ee.error.not_found")
+	h.CallError(t, "typed.fail", nil, nil, service.ErrInternal)
+}
+
+func TestRegisterFuncSignature(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "typed"})
+
+	invalid := []interface{}{
+		nil,
+		"no function",
+		func(a, b string) {},
+		func() (int, int) { return 0, 0 },
+		func() (int, int, error) { return 0, 0, nil },
+	}
+	for _, fn := range invalid {
+		if err := srv.RegisterFunc("typed.invalid", fn); err == nil {
+			t.Errorf("Expected error for handler %T", fn)
+		}
+	}
+}
+
+type temperatureEvent struct {
+	Sensor string  `json:"sensor"`
+	Value  float64 `json:"value"`
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	h := servicetest.New(t)
+	defer h.Close()
+	srv := h.Service(t, service.Config{Name: "typed"})
+
+	received := make(chan temperatureEvent, 1)
+	if err := srv.SubscribeFunc("typed.temperature", func(publisher *service.CallerID, event temperatureEvent) {
+		if publisher != nil && publisher.Session != 0 {
+			received <- event
+		}
+	}); err != nil {
+		t.Fatalf("Failed to subscribe typed handler: %v", err.Inner)
+	}
+
+	h.Publish(t, "typed.temperature", nil, wamp.Dict{"sensor": "outside", "value": "21.5"})
+	select {
+	case event := <-received:
+		if event.Sensor != "outside" || event.Value != 21.5 {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	case <-time.After(servicetest.Timeout):
+		t.Fatal("Expected event to be received")
+	}
+
+	h.Publish(t, "typed.temperature", nil, wamp.Dict{"value": "hot"})
+	deadline := time.Now().Add(servicetest.Timeout)
+	for srv.DecodeFailures() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected one decode failure, got: %d", srv.DecodeFailures())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := srv.SubscribeFunc("typed.invalid", func() int { return 0 }); err == nil {
+		t.Error("Expected error for event handler returning a value")
+	}
+}